@@ -0,0 +1,531 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the wallet service.
+//
+// Values are resolved in this order, later sources winning:
+//  1. the defaults from Default
+//  2. an optional JSON or YAML config file
+//  3. environment variables, including those loaded from an optional .env file
+//     (variables already set in the process environment take precedence over .env)
+type Config struct {
+	Server    ServerConfig    `json:"server" yaml:"server"`
+	Database  DatabaseConfig  `json:"database" yaml:"database"`
+	Log       LogConfig       `json:"log" yaml:"log"`
+	Tracing   TracingConfig   `json:"tracing" yaml:"tracing"`
+	Notifier  NotifierConfig  `json:"notifier" yaml:"notifier"`
+	Admin     AdminConfig     `json:"admin" yaml:"admin"`
+	RateLimit RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+	CORS      CORSConfig      `json:"cors" yaml:"cors"`
+	Security  SecurityConfig  `json:"security" yaml:"security"`
+	Features  FeatureConfig   `json:"features" yaml:"features"`
+}
+
+// ServerConfig configures the HTTP server.
+type ServerConfig struct {
+	Addr         string   `json:"addr" yaml:"addr"`                   // LISTEN_ADDR
+	ReadTimeout  Duration `json:"read_timeout" yaml:"read_timeout"`   // SERVER_READ_TIMEOUT
+	WriteTimeout Duration `json:"write_timeout" yaml:"write_timeout"` // SERVER_WRITE_TIMEOUT
+	IdleTimeout  Duration `json:"idle_timeout" yaml:"idle_timeout"`   // SERVER_IDLE_TIMEOUT
+
+	// PublicURL is where clients reach the service, e.g. https://wallet.example.com (PUBLIC_URL).
+	// Links in emails are built from it, never from the Host header of the request.
+	PublicURL string `json:"public_url" yaml:"public_url"`
+
+	// ShutdownTimeout bounds how long a stopping server waits for in-flight requests and then,
+	// once their connections are closed, for wallet transactions still open before closing the
+	// database (SERVER_SHUTDOWN_TIMEOUT).
+	ShutdownTimeout Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+
+	// ReadinessTimeout bounds the dependency checks of GET /readyz (SERVER_READINESS_TIMEOUT).
+	ReadinessTimeout Duration `json:"readiness_timeout" yaml:"readiness_timeout"`
+
+	// RequestTimeout is the deadline of an API request (SERVER_REQUEST_TIMEOUT): database calls
+	// still running when it passes are cancelled and the client gets 503. RouteTimeouts overrides
+	// it by route name, e.g. transactions.create (SERVER_ROUTE_TIMEOUTS="name=5s,name=2s").
+	// 0 means no deadline.
+	RequestTimeout Duration            `json:"request_timeout" yaml:"request_timeout"`
+	RouteTimeouts  map[string]Duration `json:"route_timeouts" yaml:"route_timeouts"`
+}
+
+// DatabaseConfig selects the storage backend and configures the database connection and pool.
+type DatabaseConfig struct {
+	// Driver is the storage backend (DB_DRIVER): "postgres", "sqlite" for a single database file,
+	// or "memory" to keep everything in process memory with no database at all.
+	Driver string `json:"driver" yaml:"driver"`
+
+	// Path is the SQLite database file (DB_PATH), created if it does not exist.
+	Path string `json:"path" yaml:"path"`
+
+	// The connection fields only apply to postgres; the pool and migration settings below them
+	// apply to both SQL drivers.
+	Host         string `json:"host" yaml:"host"`                     // DB_HOST
+	Port         int    `json:"port" yaml:"port"`                     // DB_PORT
+	User         string `json:"user" yaml:"user"`                     // DB_USER
+	Password     string `json:"password" yaml:"password"`             // DB_PASSWORD
+	Name         string `json:"name" yaml:"name"`                     // DB_NAME
+	SSLMode      string `json:"sslmode" yaml:"sslmode"`               // DB_SSLMODE (SSL_MODE is still read as a fallback)
+	MaxOpenConns int    `json:"max_open_conns" yaml:"max_open_conns"` // DB_MAX_OPEN_CONNS, 0 means unlimited
+	MaxIdleConns int    `json:"max_idle_conns" yaml:"max_idle_conns"` // DB_MAX_IDLE_CONNS
+
+	ConnMaxLifetime Duration `json:"conn_max_lifetime" yaml:"conn_max_lifetime"`   // DB_CONN_MAX_LIFETIME, 0 keeps connections forever
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time" yaml:"conn_max_idle_time"` // DB_CONN_MAX_IDLE_TIME, 0 keeps idle connections forever
+	ConnectTimeout  Duration `json:"connect_timeout" yaml:"connect_timeout"`       // DB_CONNECT_TIMEOUT, how long startup waits for the database
+
+	AutoMigrate bool `json:"auto_migrate" yaml:"auto_migrate"` // DB_AUTO_MIGRATE, apply pending migrations at startup
+
+	// LockTimeout bounds how long a debit or credit waits for the wallet lock held by another one
+	// before failing with "wallet busy" (DB_LOCK_TIMEOUT); 0 waits until the request deadline.
+	LockTimeout Duration `json:"lock_timeout" yaml:"lock_timeout"`
+}
+
+// LogConfig configures application logging.
+type LogConfig struct {
+	Level  string `json:"level" yaml:"level"`   // LOG_LEVEL: debug, info, warn or error
+	Format string `json:"format" yaml:"format"` // LOG_FORMAT: text (logfmt, colored on a terminal), logfmt or json
+}
+
+// TracingConfig configures OpenTelemetry tracing of HTTP requests, store calls and SQL statements.
+type TracingConfig struct {
+	// Exporter is where spans go (TRACING_EXPORTER): "none" (tracing off), "otlp" to an OTLP/HTTP
+	// collector, "stdout", or "file" to append them as JSON to File.
+	Exporter    string  `json:"exporter" yaml:"exporter"`
+	Endpoint    string  `json:"endpoint" yaml:"endpoint"`         // TRACING_ENDPOINT, host:port of the collector; empty uses the OTEL_EXPORTER_OTLP_* variables
+	Insecure    bool    `json:"insecure" yaml:"insecure"`         // TRACING_INSECURE, send to the collector over plain HTTP
+	File        string  `json:"file" yaml:"file"`                 // TRACING_FILE, required for the file exporter
+	ServiceName string  `json:"service_name" yaml:"service_name"` // TRACING_SERVICE_NAME
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"` // TRACING_SAMPLE_RATIO, fraction of new traces recorded
+}
+
+// NotifierConfig selects how user notifications (e.g. verification emails) are delivered.
+type NotifierConfig struct {
+	Kind string `json:"kind" yaml:"kind"` // NOTIFIER: log or file
+	File string `json:"file" yaml:"file"` // NOTIFIER_FILE, required for the file notifier
+}
+
+// AdminConfig configures access to the admin-only endpoints.
+type AdminConfig struct {
+	Token string `json:"token" yaml:"token"` // ADMIN_TOKEN; admin endpoints are disabled when empty
+}
+
+// RateLimitConfig configures the per-client token buckets in front of the API. Each client has one
+// bucket per route class. Clients are told apart by a valid admin token, then by a listed API key
+// (X-API-Key), and otherwise by IP address.
+type RateLimitConfig struct {
+	Enabled bool      `json:"enabled" yaml:"enabled"` // RATE_LIMIT_ENABLED
+	Read    RateLimit `json:"read" yaml:"read"`       // GET requests; RATE_LIMIT_READ_RATE, RATE_LIMIT_READ_BURST
+	Write   RateLimit `json:"write" yaml:"write"`     // changes to users; RATE_LIMIT_WRITE_RATE, RATE_LIMIT_WRITE_BURST
+	Money   RateLimit `json:"money" yaml:"money"`     // debits and credits; RATE_LIMIT_MONEY_RATE, RATE_LIMIT_MONEY_BURST
+
+	// APIKeys are the X-API-Key values that get their own buckets (RATE_LIMIT_API_KEYS, comma
+	// separated). Unlisted keys are ignored, so a client can't dodge its IP limit by making keys up.
+	APIKeys []string `json:"api_keys" yaml:"api_keys"`
+
+	// TrustForwardedFor takes the client IP from X-Forwarded-For; only enable it behind a proxy
+	// that appends to the header (RATE_LIMIT_TRUST_FORWARDED_FOR). Entries left of the ones the
+	// proxies added are whatever the client sent, so the IP is counted from the right: it is the
+	// TrustedProxies-th last entry, the last one behind a single proxy (RATE_LIMIT_TRUSTED_PROXIES).
+	TrustForwardedFor bool `json:"trust_forwarded_for" yaml:"trust_forwarded_for"`
+	TrustedProxies    int  `json:"trusted_proxies" yaml:"trusted_proxies"`
+}
+
+// RateLimit is a token bucket: Burst requests at once, refilled at Rate requests per second.
+type RateLimit struct {
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+// CORSConfig lets browser apps on other origins call the API. With no allowed origins, no CORS
+// headers are sent and browsers keep to the same-origin policy.
+type CORSConfig struct {
+	// AllowedOrigins are full origins such as https://dashboard.example.com, or "*" for any
+	// (CORS_ALLOWED_ORIGINS, comma separated).
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods" yaml:"allowed_methods"` // CORS_ALLOWED_METHODS
+	AllowedHeaders []string `json:"allowed_headers" yaml:"allowed_headers"` // CORS_ALLOWED_HEADERS, request headers scripts may send
+	ExposedHeaders []string `json:"exposed_headers" yaml:"exposed_headers"` // CORS_EXPOSED_HEADERS, response headers scripts may read
+
+	// AllowCredentials lets browsers send cookies and HTTP auth along (CORS_ALLOW_CREDENTIALS).
+	// It cannot be combined with the "*" origin.
+	AllowCredentials bool `json:"allow_credentials" yaml:"allow_credentials"`
+
+	// MaxAge is how long browsers may cache a preflight response (CORS_MAX_AGE); 0 leaves it to them.
+	MaxAge Duration `json:"max_age" yaml:"max_age"`
+}
+
+// SecurityConfig configures the security headers sent with every response.
+type SecurityConfig struct {
+	// HSTSMaxAge is how long browsers must only reach this host over HTTPS
+	// (SECURITY_HSTS_MAX_AGE); 0 omits Strict-Transport-Security.
+	HSTSMaxAge            Duration `json:"hsts_max_age" yaml:"hsts_max_age"`
+	HSTSIncludeSubdomains bool     `json:"hsts_include_subdomains" yaml:"hsts_include_subdomains"` // SECURITY_HSTS_INCLUDE_SUBDOMAINS
+}
+
+// FeatureConfig holds feature toggles and tunables.
+type FeatureConfig struct {
+	RequireEmailVerification bool     `json:"require_email_verification" yaml:"require_email_verification"` // FEATURE_REQUIRE_EMAIL_VERIFICATION
+	UserRestoreWindow        Duration `json:"user_restore_window" yaml:"user_restore_window"`               // USER_RESTORE_WINDOW
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:         ":8080",
+			PublicURL:    "http://localhost:8080",
+			ReadTimeout:  Duration(15 * time.Second),
+			WriteTimeout: Duration(30 * time.Second),
+			IdleTimeout:  Duration(60 * time.Second),
+
+			ShutdownTimeout:  Duration(30 * time.Second),
+			ReadinessTimeout: Duration(2 * time.Second),
+			RequestTimeout:   Duration(10 * time.Second),
+			RouteTimeouts:    map[string]Duration{"transactions.create": Duration(5 * time.Second)},
+		},
+		Database: DatabaseConfig{
+			Driver:       "postgres",
+			Path:         "wallet.db",
+			Host:         "localhost",
+			Port:         5432,
+			User:         "postgres",
+			Name:         "account",
+			SSLMode:      "disable",
+			MaxOpenConns: 25,
+			MaxIdleConns: 5,
+
+			ConnMaxLifetime: Duration(30 * time.Minute),
+			ConnMaxIdleTime: Duration(5 * time.Minute),
+			ConnectTimeout:  Duration(30 * time.Second),
+			LockTimeout:     Duration(2 * time.Second),
+		},
+		Log:      LogConfig{Level: "info", Format: "text"},
+		Tracing:  TracingConfig{Exporter: "none", ServiceName: "wallet-system", SampleRatio: 1},
+		Notifier: NotifierConfig{Kind: "log"},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Read:    RateLimit{Rate: 20, Burst: 40},
+			Write:   RateLimit{Rate: 5, Burst: 10},
+			Money:   RateLimit{Rate: 2, Burst: 5},
+
+			TrustedProxies: 1,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "If-Match", "X-Request-ID", "X-API-Key", "X-Admin-Token"},
+			ExposedHeaders: []string{"ETag", "X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After", "Deprecation", "Link"},
+			MaxAge:         Duration(10 * time.Minute),
+		},
+		Security: SecurityConfig{HSTSMaxAge: Duration(365 * 24 * time.Hour)},
+		Features: FeatureConfig{
+			RequireEmailVerification: true,
+			UserRestoreWindow:        Duration(30 * 24 * time.Hour),
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the config file at path (skipped when path is
+// empty), the .env file in the working directory (skipped when missing) and the environment,
+// then validates it.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading .env: %w", err)
+	}
+	if err := errors.Join(cfg.loadEnv(), cfg.Validate()); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the JSON or YAML file at path, chosen by its extension.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension, use .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overlays every environment variable that is set.
+func (c *Config) loadEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	num := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an integer", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	flag := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+		}
+	}
+	ratio := func(name string, dst *float64) {
+		if v, ok := os.LookupEnv(name); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", name, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	duration := func(name string, dst *Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration", name, v))
+				return
+			}
+			*dst = Duration(d)
+		}
+	}
+	durations := func(name string, dst *map[string]Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = map[string]Duration{}
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(item, "=")
+				d, err := time.ParseDuration(strings.TrimSpace(value))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %q is not name=duration", name, item))
+					continue
+				}
+				(*dst)[strings.TrimSpace(key)] = Duration(d)
+			}
+		}
+	}
+
+	str("LISTEN_ADDR", &c.Server.Addr)
+	str("PUBLIC_URL", &c.Server.PublicURL)
+	duration("SERVER_READ_TIMEOUT", &c.Server.ReadTimeout)
+	duration("SERVER_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	duration("SERVER_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	duration("SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	duration("SERVER_READINESS_TIMEOUT", &c.Server.ReadinessTimeout)
+	duration("SERVER_REQUEST_TIMEOUT", &c.Server.RequestTimeout)
+	durations("SERVER_ROUTE_TIMEOUTS", &c.Server.RouteTimeouts)
+
+	str("DB_DRIVER", &c.Database.Driver)
+	str("DB_PATH", &c.Database.Path)
+	str("DB_HOST", &c.Database.Host)
+	num("DB_PORT", &c.Database.Port)
+	str("DB_USER", &c.Database.User)
+	str("DB_PASSWORD", &c.Database.Password)
+	str("DB_NAME", &c.Database.Name)
+	str("SSL_MODE", &c.Database.SSLMode) // older name, kept for existing deployments
+	str("DB_SSLMODE", &c.Database.SSLMode)
+	num("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	num("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	duration("DB_CONN_MAX_IDLE_TIME", &c.Database.ConnMaxIdleTime)
+	duration("DB_CONNECT_TIMEOUT", &c.Database.ConnectTimeout)
+	flag("DB_AUTO_MIGRATE", &c.Database.AutoMigrate)
+	duration("DB_LOCK_TIMEOUT", &c.Database.LockTimeout)
+
+	str("LOG_LEVEL", &c.Log.Level)
+	str("LOG_FORMAT", &c.Log.Format)
+
+	str("TRACING_EXPORTER", &c.Tracing.Exporter)
+	str("TRACING_ENDPOINT", &c.Tracing.Endpoint)
+	flag("TRACING_INSECURE", &c.Tracing.Insecure)
+	str("TRACING_FILE", &c.Tracing.File)
+	str("TRACING_SERVICE_NAME", &c.Tracing.ServiceName)
+	ratio("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+
+	str("NOTIFIER", &c.Notifier.Kind)
+	str("NOTIFIER_FILE", &c.Notifier.File)
+
+	str("ADMIN_TOKEN", &c.Admin.Token)
+
+	flag("RATE_LIMIT_ENABLED", &c.RateLimit.Enabled)
+	ratio("RATE_LIMIT_READ_RATE", &c.RateLimit.Read.Rate)
+	num("RATE_LIMIT_READ_BURST", &c.RateLimit.Read.Burst)
+	ratio("RATE_LIMIT_WRITE_RATE", &c.RateLimit.Write.Rate)
+	num("RATE_LIMIT_WRITE_BURST", &c.RateLimit.Write.Burst)
+	ratio("RATE_LIMIT_MONEY_RATE", &c.RateLimit.Money.Rate)
+	num("RATE_LIMIT_MONEY_BURST", &c.RateLimit.Money.Burst)
+	list("RATE_LIMIT_API_KEYS", &c.RateLimit.APIKeys)
+	flag("RATE_LIMIT_TRUST_FORWARDED_FOR", &c.RateLimit.TrustForwardedFor)
+	num("RATE_LIMIT_TRUSTED_PROXIES", &c.RateLimit.TrustedProxies)
+
+	list("CORS_ALLOWED_ORIGINS", &c.CORS.AllowedOrigins)
+	list("CORS_ALLOWED_METHODS", &c.CORS.AllowedMethods)
+	list("CORS_ALLOWED_HEADERS", &c.CORS.AllowedHeaders)
+	list("CORS_EXPOSED_HEADERS", &c.CORS.ExposedHeaders)
+	flag("CORS_ALLOW_CREDENTIALS", &c.CORS.AllowCredentials)
+	duration("CORS_MAX_AGE", &c.CORS.MaxAge)
+
+	duration("SECURITY_HSTS_MAX_AGE", &c.Security.HSTSMaxAge)
+	flag("SECURITY_HSTS_INCLUDE_SUBDOMAINS", &c.Security.HSTSIncludeSubdomains)
+
+	flag("FEATURE_REQUIRE_EMAIL_VERIFICATION", &c.Features.RequireEmailVerification)
+	duration("USER_RESTORE_WINDOW", &c.Features.UserRestoreWindow)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr (LISTEN_ADDR) is required")
+	public, err := url.Parse(c.Server.PublicURL)
+	check(err == nil && (public.Scheme == "http" || public.Scheme == "https") && public.Host != "" && public.RawQuery == "" && public.Fragment == "",
+		"server.public_url (PUBLIC_URL) must be an absolute http or https URL without query, got %q", c.Server.PublicURL)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.ReadinessTimeout > 0, "server.readiness_timeout must be positive")
+	// A deadline past the write timeout would never be seen: the server drops the connection first
+	check(c.Server.RequestTimeout >= 0 && c.Server.RequestTimeout < c.Server.WriteTimeout,
+		"server.request_timeout must be between 0 and server.write_timeout (%s), got %s", c.Server.WriteTimeout, c.Server.RequestTimeout)
+	routes := make([]string, 0, len(c.Server.RouteTimeouts))
+	for name := range c.Server.RouteTimeouts {
+		routes = append(routes, name)
+	}
+	sort.Strings(routes)
+	for _, name := range routes {
+		d := c.Server.RouteTimeouts[name]
+		check(d > 0 && d < c.Server.WriteTimeout, "server.route_timeouts.%s must be positive and below server.write_timeout (%s), got %s", name, c.Server.WriteTimeout, d)
+	}
+
+	check(oneOf(c.Database.Driver, "postgres", "sqlite", "memory"), "database.driver (DB_DRIVER) must be postgres, sqlite or memory, got %q", c.Database.Driver)
+	if c.Database.Driver == "sqlite" {
+		check(c.Database.Path != "", "database.path (DB_PATH) is required for the sqlite driver")
+	}
+	if c.Database.Driver == "postgres" {
+		check(c.Database.Host != "", "database.host (DB_HOST) is required")
+		check(c.Database.Port > 0 && c.Database.Port < 65536, "database.port (DB_PORT) must be between 1 and 65535, got %d", c.Database.Port)
+		check(c.Database.User != "", "database.user (DB_USER) is required")
+		check(c.Database.Name != "", "database.name (DB_NAME) is required")
+		check(oneOf(c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+			"database.sslmode (DB_SSLMODE) must be one of disable, allow, prefer, require, verify-ca or verify-full, got %q", c.Database.SSLMode)
+	}
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns (%d) must not exceed database.max_open_conns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.ConnectTimeout >= 0, "database.connect_timeout must not be negative")
+	check(c.Database.LockTimeout >= 0, "database.lock_timeout must not be negative")
+
+	check(oneOf(c.Log.Level, "debug", "info", "warn", "error"), "log.level (LOG_LEVEL) must be one of debug, info, warn or error, got %q", c.Log.Level)
+	check(oneOf(c.Log.Format, "text", "logfmt", "json"), "log.format (LOG_FORMAT) must be text, logfmt or json, got %q", c.Log.Format)
+
+	check(oneOf(c.Tracing.Exporter, "none", "otlp", "stdout", "file"), "tracing.exporter (TRACING_EXPORTER) must be none, otlp, stdout or file, got %q", c.Tracing.Exporter)
+	check(c.Tracing.Exporter != "file" || c.Tracing.File != "", "tracing.file (TRACING_FILE) is required for the file exporter")
+	check(c.Tracing.ServiceName != "", "tracing.service_name (TRACING_SERVICE_NAME) is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio (TRACING_SAMPLE_RATIO) must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+
+	check(oneOf(c.Notifier.Kind, "log", "file"), "notifier.kind (NOTIFIER) must be log or file, got %q", c.Notifier.Kind)
+	check(c.Notifier.Kind != "file" || c.Notifier.File != "", "notifier.file (NOTIFIER_FILE) is required for the file notifier")
+
+	if c.RateLimit.Enabled {
+		for _, l := range []struct {
+			name string
+			RateLimit
+		}{{"read", c.RateLimit.Read}, {"write", c.RateLimit.Write}, {"money", c.RateLimit.Money}} {
+			check(l.Rate > 0, "rate_limit.%s.rate must be positive, got %v", l.name, l.Rate)
+			check(l.Burst >= 1, "rate_limit.%s.burst must be at least 1, got %d", l.name, l.Burst)
+		}
+		check(!c.RateLimit.TrustForwardedFor || c.RateLimit.TrustedProxies >= 1,
+			"rate_limit.trusted_proxies (RATE_LIMIT_TRUSTED_PROXIES) must be at least 1, got %d", c.RateLimit.TrustedProxies)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			check(!c.CORS.AllowCredentials, "cors.allowed_origins cannot include \"*\" when cors.allow_credentials is set")
+			continue
+		}
+		u, err := url.Parse(origin)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == "",
+			"cors.allowed_origins: %q is not an origin like https://app.example.com", origin)
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+	check(c.Security.HSTSMaxAge >= 0, "security.hsts_max_age must not be negative")
+
+	check(c.Features.UserRestoreWindow >= 0, "features.user_restore_window must not be negative")
+
+	return errors.Join(errs...)
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"wallet-system/response"
+)
+
+// StatusClientClosedRequest is the status recorded for a request whose client disconnected before
+// it was answered, after the nginx convention. The client never sees it.
+const StatusClientClosedRequest = 499
+
+// serverError answers a request whose store call failed with err. When the request's context
+// ended first, err is only a consequence of that: a passed deadline gets 503, and a client that
+// went away gets nothing. Any other failure is logged and answered with 500 and message.
+func serverError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch ctxErr := r.Context().Err(); {
+	case errors.Is(ctxErr, context.DeadlineExceeded):
+		slog.WarnContext(r.Context(), "Request deadline exceeded", "err", err)
+		response.Error(w, r, http.StatusServiceUnavailable, response.CodeTimeout, "Request timed out, retry")
+	case errors.Is(ctxErr, context.Canceled):
+		slog.InfoContext(r.Context(), "Client disconnected", "err", err)
+		w.WriteHeader(StatusClientClosedRequest)
+	default:
+		slog.ErrorContext(r.Context(), message, "err", err)
+		response.Error(w, r, http.StatusInternalServerError, response.CodeInternal, message)
+	}
+}
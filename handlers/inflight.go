@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// InflightTracker counts wallet transactions that are between BEGIN and COMMIT/ROLLBACK,
+// so a shutting-down server can wait for them before closing the database pool.
+type InflightTracker struct {
+	mu       sync.Mutex
+	open     int
+	draining bool
+	idle     chan struct{} // closed once draining and no transaction is open
+}
+
+// Start registers a wallet transaction; call the returned function once it has committed or
+// rolled back. Once Drain has been called it registers nothing and returns ok == false: the
+// caller must not begin the transaction.
+func (t *InflightTracker) Start() (done func(), ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, false
+	}
+	t.open++
+
+	var once sync.Once
+	return func() { once.Do(t.finish) }, true
+}
+
+func (t *InflightTracker) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open--
+	if t.open == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// Drain refuses every later Start and blocks until the registered transactions are done, or
+// until ctx is done.
+func (t *InflightTracker) Drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	if t.open == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
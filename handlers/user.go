@@ -1,259 +1,391 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"wallet-system/middleware"
+	"wallet-system/models"
+	"wallet-system/notify"
+	"wallet-system/response"
+	database "wallet-system/storage"
+	"wallet-system/validation"
 
 	"github.com/gorilla/mux"
 )
 
-// validateName validates a name field (Fname or Lname) based on defined rules.
-func validateName(name string, fieldName string) error {
-	if name == "" {
-		return fmt.Errorf("%s is required", fieldName)
+// userRequest is the body of the create and full-update endpoints.
+type userRequest struct {
+	Username string `json:"username" validate:"required,username" label:"Username"`
+	Fname    string `json:"fname" validate:"required,name" label:"First name"`
+	Lname    string `json:"lname" validate:"required,name" label:"Last name"`
+	Email    string `json:"email" validate:"required,email" label:"Email"`
+}
+
+func (req *userRequest) Normalize() {
+	req.Email = validation.NormalizeEmail(req.Email)
+}
+
+// patchUserRequest is the body of the partial-update endpoint; nil fields were not supplied.
+type patchUserRequest struct {
+	Username *string `json:"username" validate:"username" label:"Username"`
+	Fname    *string `json:"fname" validate:"name" label:"First name"`
+	Lname    *string `json:"lname" validate:"name" label:"Last name"`
+	Email    *string `json:"email" validate:"email" label:"Email"`
+}
+
+func (req *patchUserRequest) Normalize() {
+	if req.Email != nil {
+		email := validation.NormalizeEmail(*req.Email)
+		req.Email = &email
 	}
-	if strings.TrimSpace(name) != name {
-		return fmt.Errorf("%s cannot have leading or trailing spaces", fieldName)
+}
+
+// conflictError writes the 409 response for database.ErrUsernameTaken or database.ErrEmailTaken.
+func conflictError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, database.ErrEmailTaken) {
+		response.Error(w, r, http.StatusConflict, response.CodeEmailTaken, "email is already registered",
+			response.FieldError{Field: "email", Message: "email is already registered"})
+		return
 	}
-	if regexp.MustCompile(`[0-9]`).MatchString(name) {
-		return fmt.Errorf("%s cannot contain numbers", fieldName)
+	response.Error(w, r, http.StatusConflict, response.CodeUsernameTaken, "username is already taken",
+		response.FieldError{Field: "username", Message: "username is already taken"})
+}
+
+// userIDParam parses the {id} path variable, writing a 400 response when it isn't a positive integer.
+func userIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		response.ValidationError(w, r, response.FieldError{Field: "id", Message: "Invalid User ID"})
+		return 0, false
 	}
-	if regexp.MustCompile(`[^a-zA-Z\s]`).MatchString(name) {
-		return fmt.Errorf("%s can only contain alphabetic characters and spaces", fieldName)
+	return id, true
+}
+
+// userAction is the response body of the user lifecycle endpoints (deactivate, restore, purge, ...).
+type userAction struct {
+	ID      int    `json:"id"`
+	Message string `json:"message"`
+}
+
+// userETag formats a user row version as a strong entity tag.
+func userETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseIfMatch reads the If-Match header as a user version.
+// version is nil when the header is absent or "*", i.e. the update is unconditional.
+func parseIfMatch(r *http.Request) (version *int, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
 	}
-	if strings.Contains(name, " ") {
-		return fmt.Errorf("%s cannot have spaces", fieldName)
+	v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil {
+		return nil, fmt.Errorf("If-Match must be an ETag returned by the user details endpoint")
 	}
-	if len(name) < 3 || len(name) > 50 {
-		return fmt.Errorf("%s must be between 3 and 50 characters long", fieldName)
+	return &v, nil
+}
+
+// writeUpdateError writes the response for an error returned by UserStore.Update.
+func writeUpdateError(w http.ResponseWriter, r *http.Request, id int, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound, fmt.Sprintf("User not found with ID %d", id))
+	case errors.Is(err, database.ErrUserDeactivated):
+		response.Error(w, r, http.StatusConflict, response.CodeUserDeactivated, fmt.Sprintf("User with ID %d is deactivated", id))
+	case errors.Is(err, database.ErrUsernameTaken), errors.Is(err, database.ErrEmailTaken):
+		conflictError(w, r, err)
+	case errors.Is(err, database.ErrVersionMismatch):
+		response.Error(w, r, http.StatusPreconditionFailed, response.CodePreconditionFailed, "User has been modified since it was read")
+	default:
+		serverError(w, r, err, "Failed to update user")
 	}
-	return nil
 }
 
 // CreateUser: Creates a new user in the database
-func CreateUser(db *sql.DB) http.HandlerFunc {
+func CreateUser(users database.UserStore, n notify.Notifier, publicURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse the JSON body
-		var requestData struct {
-			Username string `json:"username"`
-			Fname    string `json:"fname"`
-			Lname    string `json:"lname"`
-			Email    string `json:"email"`
-		}
-
-		// Decode JSON
-		err := json.NewDecoder(r.Body).Decode(&requestData)
-		if err != nil {
-			http.Error(w, "Invalid JSON input", http.StatusBadRequest)
+		// Parse and validate the JSON body
+		var requestData userRequest
+		if !validation.Bind(w, r, &requestData) {
 			return
 		}
 
-		// Validate input fields
-		if err := validateName(requestData.Fname, "First Name"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		// Insert the user, rejecting a username or email that is already in use
+		user, err := users.Create(r.Context(), database.NewUser{
+			Username: requestData.Username,
+			Fname:    requestData.Fname,
+			Lname:    requestData.Lname,
+			Email:    requestData.Email,
+		})
+		if errors.Is(err, database.ErrUsernameTaken) || errors.Is(err, database.ErrEmailTaken) {
+			conflictError(w, r, err)
 			return
 		}
-		if err := validateName(requestData.Lname, "Last Name"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if requestData.Username == "" {
-			http.Error(w, "Username is required", http.StatusBadRequest)
+		if err != nil {
+			serverError(w, r, err, "Failed to create user")
 			return
 		}
+		middleware.SetUserID(r.Context(), user.ID)
 
-		// Validate input: Email
-		if requestData.Email == "" || !regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`).MatchString(requestData.Email) {
-			http.Error(w, "Valid email is required", http.StatusBadRequest)
-			return
+		// New users start unverified; a failed send is logged and can be retried via the resend endpoint
+		if err := issueVerification(r, users, n, publicURL, user.ID, user.Email); err != nil {
+			slog.ErrorContext(r.Context(), "Error sending verification email", "user_id", user.ID, "err", err)
 		}
 
-		// Insert user into the database
-		query := `INSERT INTO users (username, fname, lname, email) VALUES ($1, $2, $3, $4) RETURNING id`
-		var id int
-		err = db.QueryRow(query, requestData.Username, requestData.Fname, requestData.Lname, requestData.Email).Scan(&id)
-		if err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
-			fmt.Println("Error inserting user:", err)
-			return
-		}
-
-		// Respond with success
-		w.WriteHeader(http.StatusCreated)
-		fmt.Fprintf(w, "User created successfully with ID: %d\n", id)
+		// Respond with the created user
+		w.Header().Set("ETag", userETag(user.Version))
+		response.JSON(w, http.StatusCreated, user)
 	}
 }
 
 // UpdateUser:- updates a user's details (e.g., username, fname, lname, email)
-func UpdateUser(db *sql.DB) http.HandlerFunc {
+func UpdateUser(users database.UserStore, n notify.Notifier, publicURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get user ID from URL
-		id := mux.Vars(r)["id"]
-		if id == "" {
-			http.Error(w, "ID is required", http.StatusBadRequest)
+		id, ok := userIDParam(w, r)
+		if !ok {
 			return
 		}
 
-		// Check if the user exists
-		var exists bool
-		err1 := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", id).Scan(&exists)
-		if err1 != nil {
-			log.Printf("Error checking user existence: %v", err1)
-			http.Error(w, "Error checking user existence", http.StatusInternalServerError)
+		// Parse and validate the JSON body
+		var requestData userRequest
+		if !validation.Bind(w, r, &requestData) {
 			return
 		}
 
-		// If the user doesn't exist, return a "user not found" message
-		if !exists {
-			http.Error(w, fmt.Sprintf("User not found with ID %s", id), http.StatusNotFound)
+		// Honour If-Match so a stale client can't overwrite a newer version
+		expectedVersion, err := parseIfMatch(r)
+		if err != nil {
+			response.ValidationError(w, r, response.FieldError{Field: "If-Match", Message: err.Error()})
 			return
 		}
 
-		// Parse the JSON body
-		var requestData struct {
-			Username string `json:"username"`
-			Fname    string `json:"fname"`
-			Lname    string `json:"lname"`
-			Email    string `json:"email"`
+		// Replace every field; a changed email has to be verified again
+		before, err := users.Get(r.Context(), id)
+		if err != nil {
+			writeUpdateError(w, r, id, err)
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-			http.Error(w, "Invalid JSON input", http.StatusBadRequest)
+		user, err := users.Update(r.Context(), id, database.UserChanges{
+			Username: &requestData.Username,
+			Fname:    &requestData.Fname,
+			Lname:    &requestData.Lname,
+			Email:    &requestData.Email,
+		}, expectedVersion)
+		if err != nil {
+			writeUpdateError(w, r, id, err)
 			return
 		}
+		if user.Email != before.Email && user.EmailVerifiedAt == nil {
+			sendPendingVerification(r, users, n, publicURL, user.ID, user.Email)
+		}
+
+		// Respond with the updated user
+		w.Header().Set("ETag", userETag(user.Version))
+		response.JSON(w, http.StatusOK, user)
+	}
+}
 
-		// Validate inputs
-		if requestData.Username == "" || requestData.Fname == "" || requestData.Lname == "" {
-			http.Error(w, "Username, Fname, and Lname are required", http.StatusBadRequest)
+// PatchUser:- partially updates a user; only the fields present in the body are changed
+func PatchUser(users database.UserStore, n notify.Notifier, publicURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from URL
+		id, ok := userIDParam(w, r)
+		if !ok {
 			return
 		}
 
-		// Validate first name
-		if err := validateName(requestData.Fname, "First name"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		// Parse and validate the supplied fields
+		var requestData patchUserRequest
+		if !validation.Bind(w, r, &requestData) {
 			return
 		}
-
-		// Validate last name
-		if err := validateName(requestData.Lname, "Last name"); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if requestData.Username == nil && requestData.Fname == nil && requestData.Lname == nil && requestData.Email == nil {
+			response.ValidationError(w, r, response.FieldError{Field: "body", Message: "At least one of username, fname, lname or email is required"})
 			return
 		}
 
-		// Validate input: Email
-		if requestData.Email == "" || !regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`).MatchString(requestData.Email) {
-			http.Error(w, "Valid email is required", http.StatusBadRequest)
+		expectedVersion, err := parseIfMatch(r)
+		if err != nil {
+			response.ValidationError(w, r, response.FieldError{Field: "If-Match", Message: err.Error()})
 			return
 		}
 
-		// Update the user in the database
-		query := `UPDATE users SET username = $1, fname = $2, lname = $3, email = $4 WHERE id = $5`
-		_, err := db.Exec(query, requestData.Username, requestData.Fname, requestData.Lname, requestData.Email, id)
+		// Only a changed email needs a new verification link, so remember the old one
+		var before models.User
+		if requestData.Email != nil {
+			if before, err = users.Get(r.Context(), id); err != nil {
+				writeUpdateError(w, r, id, err)
+				return
+			}
+		}
+		user, err := users.Update(r.Context(), id, database.UserChanges{
+			Username: requestData.Username,
+			Fname:    requestData.Fname,
+			Lname:    requestData.Lname,
+			Email:    requestData.Email,
+		}, expectedVersion)
 		if err != nil {
-			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			writeUpdateError(w, r, id, err)
 			return
 		}
+		if requestData.Email != nil && user.Email != before.Email && user.EmailVerifiedAt == nil {
+			sendPendingVerification(r, users, n, publicURL, user.ID, user.Email)
+		}
 
-		// Send a success response
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "User with ID %s updated successfully", id)
+		w.Header().Set("ETag", userETag(user.Version))
+		response.JSON(w, http.StatusOK, user)
 	}
 }
 
 // Get User Details
-func GetUserDetails(db *sql.DB) http.HandlerFunc {
+func GetUserDetails(users database.UserStore, transactions database.TransactionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract ID from the path parameters
-		vars := mux.Vars(r)
-		id := vars["id"]
-		if id == "" {
-			http.Error(w, "id is required", http.StatusBadRequest)
+		userID, ok := userIDParam(w, r)
+		if !ok {
+			return
+		}
+
+		// Fetch the user and the number of transactions they made
+		u, err := users.Get(r.Context(), userID)
+		if errors.Is(err, database.ErrNotFound) {
+			response.Error(w, r, http.StatusNotFound, response.CodeNotFound, "User not found")
 			return
 		}
-		userID, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, "Invalid User ID", http.StatusBadRequest)
-			return
-		}
-
-		// Fetch user details from the database
-		var user struct {
-			ID                int    `json:"id"`
-			Username          string `json:"username"`
-			FirstName         string `json:"fname"`
-			LastName          string `json:"lname"`
-			Email             string `json:"email"`
-			TotalTransactions int    `json:"total_transactions"`
-		}
-
-		query := `
-			SELECT 
-				u.id, u.username, u.fname, u.lname, u.email, 
-				(SELECT COUNT(*) FROM transactions t WHERE t.user_id = u.id) AS total_transactions
-			FROM users u
-			WHERE u.id = $1
-		`
-
-		err = db.QueryRow(query, userID).Scan(
-			&user.ID,
-			&user.Username,
-			&user.FirstName,
-			&user.LastName,
-			&user.Email,
-			&user.TotalTransactions,
-		)
+			serverError(w, r, err, "Error fetching user details")
+			return
+		}
+		summary, err := transactions.Summary(r.Context(), userID)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				http.Error(w, "User not found", http.StatusNotFound)
-				return
-			}
-			http.Error(w, "Error fetching user details", http.StatusInternalServerError)
+			serverError(w, r, err, "Error fetching user details")
 			return
 		}
 
-		// Return the user details as JSON
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(user)
+		user := struct {
+			ID                int        `json:"id"`
+			Username          string     `json:"username"`
+			FirstName         string     `json:"fname"`
+			LastName          string     `json:"lname"`
+			Email             string     `json:"email"`
+			TotalTransactions int        `json:"total_transactions"`
+			EmailVerified     bool       `json:"email_verified"`
+			Version           int        `json:"version"`
+			DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+		}{u.ID, u.Username, u.Fname, u.Lname, u.Email, summary.TotalTransactions, u.EmailVerifiedAt != nil, u.Version, u.DeletedAt}
+
+		// Return the user details as JSON, with the version as ETag for If-Match
+		w.Header().Set("ETag", userETag(user.Version))
+		response.JSON(w, http.StatusOK, user)
 	}
 }
 
-// DeleteUser:- Delete user by ID
-func DeleteUser(db *sql.DB) http.HandlerFunc {
+// DeleteUser:- Deactivate (soft delete) user by ID
+func DeleteUser(users database.UserStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get user ID from URL parameter
-		vars := mux.Vars(r)
-		userID := vars["id"]
+		userID, ok := userIDParam(w, r)
+		if !ok {
+			return
+		}
+
+		// Mark the user as deactivated; the row stays so transaction history keeps resolving
+		err := users.Deactivate(r.Context(), userID)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			response.Error(w, r, http.StatusNotFound, response.CodeNotFound, fmt.Sprintf("User not found with ID %d", userID))
+			return
+		case errors.Is(err, database.ErrUserDeactivated):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, fmt.Sprintf("User with ID %d is already deactivated", userID))
+			return
+		case err != nil:
+			serverError(w, r, err, "Error deactivating user")
+			return
+		}
 
-		// Check if the user exists
-		var exists bool
-		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+		response.JSON(w, http.StatusOK, userAction{ID: userID, Message: "User deactivated, transactions kept"})
+	}
+}
+
+// RestoreUser:- Reactivate a deactivated user, as long as it was deactivated less than window ago and is not purged
+func RestoreUser(users database.UserStore, window time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userIDParam(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := users.Get(r.Context(), userID)
+		if errors.Is(err, database.ErrNotFound) {
+			response.Error(w, r, http.StatusNotFound, response.CodeNotFound, fmt.Sprintf("User not found with ID %d", userID))
+			return
+		}
 		if err != nil {
-			log.Printf("Error checking user existence: %v", err)
-			http.Error(w, "Error checking user existence", http.StatusInternalServerError)
+			serverError(w, r, err, "Error checking user existence")
 			return
 		}
 
-		// If the user doesn't exist, return a "user not found" message
-		if !exists {
-			http.Error(w, fmt.Sprintf("User not found with ID %s", userID), http.StatusNotFound)
+		notDeactivated := func() {
+			response.Error(w, r, http.StatusConflict, response.CodeUserNotDeactivated, fmt.Sprintf("User with ID %d is not deactivated", userID))
+		}
+		switch {
+		case user.PurgedAt != nil:
+			response.Error(w, r, http.StatusGone, response.CodeGone, fmt.Sprintf("User with ID %d has been purged and cannot be restored", userID))
+			return
+		case user.DeletedAt == nil:
+			notDeactivated()
+			return
+		case time.Since(*user.DeletedAt) > window:
+			response.Error(w, r, http.StatusGone, response.CodeGone, fmt.Sprintf("Restore window for user with ID %d has expired", userID))
 			return
 		}
 
-		// Delete the user from the users table
-		_, err = db.Exec("DELETE FROM users WHERE id = $1", userID)
+		// ErrNotFound here means another request restored or purged the user in the meantime
+		err = users.Restore(r.Context(), userID)
+		if errors.Is(err, database.ErrNotFound) {
+			notDeactivated()
+			return
+		}
 		if err != nil {
-			log.Printf("Error deleting user: %v", err)
-			http.Error(w, "Error deleting user", http.StatusInternalServerError)
+			serverError(w, r, err, "Error restoring user")
+			return
+		}
+
+		response.JSON(w, http.StatusOK, userAction{ID: userID, Message: "User restored"})
+	}
+}
+
+// PurgeUser:- Anonymize a user's personal data (GDPR erasure).
+// The users row and every transaction stay in place so the ledger still balances;
+// only the name, username and email are replaced with placeholders.
+func PurgeUser(users database.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userIDParam(w, r)
+		if !ok {
+			return
+		}
+
+		err := users.Purge(r.Context(), userID)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			response.Error(w, r, http.StatusNotFound, response.CodeNotFound, fmt.Sprintf("User not found with ID %d", userID))
+			return
+		case errors.Is(err, database.ErrUserPurged):
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, fmt.Sprintf("User with ID %d is already purged", userID))
+			return
+		case err != nil:
+			serverError(w, r, err, "Error purging user")
 			return
 		}
 
-		// Optionally, log the deletion or return a response
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("User deleted, transactions kept"))
+		response.JSON(w, http.StatusOK, userAction{ID: userID, Message: "User purged, transactions kept"})
 	}
 }
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"wallet-system/models"
+	"wallet-system/response"
+	database "wallet-system/storage"
+)
+
+const (
+	defaultUsersPageSize = 20
+	maxUsersPageSize     = 100
+)
+
+// parseUserListTime accepts either an RFC 3339 timestamp or a plain YYYY-MM-DD date.
+func parseUserListTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// ListUsers:- Lists users with pagination, prefix search, state filters and sorting
+//
+// Query parameters:
+//   - page, page_size: 1-based page number and page size (default 20, max 100)
+//   - q: case-insensitive prefix of username, first name, last name or email
+//   - status: active, deleted or all (default all)
+//   - verified: true or false
+//   - created_from, created_to: RFC 3339 timestamps or YYYY-MM-DD dates (inclusive)
+//   - sort: id, username, email or created_at, prefixed with "-" for descending (default id)
+func ListUsers(store database.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		// Pagination
+		page, pageSize := 1, defaultUsersPageSize
+		if v := params.Get("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				response.ValidationError(w, r, response.FieldError{Field: "page", Message: "page must be a positive integer"})
+				return
+			}
+			page = n
+		}
+		if v := params.Get("page_size"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxUsersPageSize {
+				response.ValidationError(w, r, response.FieldError{Field: "page_size", Message: fmt.Sprintf("page_size must be between 1 and %d", maxUsersPageSize)})
+				return
+			}
+			pageSize = n
+		}
+
+		// Filters
+		filter := database.UserFilter{
+			Query:  strings.TrimSpace(params.Get("q")),
+			Limit:  pageSize,
+			Offset: (page - 1) * pageSize,
+		}
+
+		switch status := params.Get("status"); status {
+		case "", "all":
+		case "active", "deleted":
+			filter.Status = status
+		default:
+			response.ValidationError(w, r, response.FieldError{Field: "status", Message: "status must be one of active, deleted or all"})
+			return
+		}
+
+		switch params.Get("verified") {
+		case "":
+		case "true", "false":
+			verified := params.Get("verified") == "true"
+			filter.Verified = &verified
+		default:
+			response.ValidationError(w, r, response.FieldError{Field: "verified", Message: "verified must be true or false"})
+			return
+		}
+
+		if v := params.Get("created_from"); v != "" {
+			t, err := parseUserListTime(v)
+			if err != nil {
+				response.ValidationError(w, r, response.FieldError{Field: "created_from", Message: "created_from must be an RFC 3339 timestamp or a YYYY-MM-DD date"})
+				return
+			}
+			filter.CreatedFrom = &t
+		}
+		if v := params.Get("created_to"); v != "" {
+			t, err := parseUserListTime(v)
+			if err != nil {
+				response.ValidationError(w, r, response.FieldError{Field: "created_to", Message: "created_to must be an RFC 3339 timestamp or a YYYY-MM-DD date"})
+				return
+			}
+			// A bare date covers the whole day
+			if len(v) == len("2006-01-02") {
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			filter.CreatedTo = &t
+		}
+
+		// Sorting
+		sortKey := params.Get("sort")
+		if strings.HasPrefix(sortKey, "-") {
+			sortKey, filter.Descending = sortKey[1:], true
+		}
+		if sortKey != "" && !slices.Contains(database.UserSortFields, sortKey) {
+			response.ValidationError(w, r, response.FieldError{Field: "sort", Message: "sort must be one of id, username, email or created_at"})
+			return
+		}
+		filter.Sort = sortKey
+
+		users, total, err := store.List(r.Context(), filter)
+		if err != nil {
+			serverError(w, r, err, "Error fetching users")
+			return
+		}
+
+		result := struct {
+			Users    []models.User `json:"users"`
+			Page     int           `json:"page"`
+			PageSize int           `json:"page_size"`
+			Total    int           `json:"total"`
+		}{users, page, pageSize, total}
+
+		response.JSON(w, http.StatusOK, result)
+	}
+}
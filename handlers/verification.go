@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"wallet-system/notify"
+	"wallet-system/response"
+	database "wallet-system/storage"
+)
+
+// VerificationTokenTTL is how long an email verification link stays valid.
+const VerificationTokenTTL = 24 * time.Hour
+
+// hashToken returns the hex SHA-256 of a verification token; only the hash is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// verificationLink builds the absolute URL the user follows to confirm their email. It is based on
+// the configured publicURL: the request's Host header is chosen by the client.
+func verificationLink(publicURL, token string) string {
+	return fmt.Sprintf("%s/api/v1/users/verify?token=%s", strings.TrimSuffix(publicURL, "/"), url.QueryEscape(token))
+}
+
+// issueVerification creates a verification token for the user's email and sends the link, based on
+// publicURL, through n.
+func issueVerification(r *http.Request, users database.UserStore, n notify.Notifier, publicURL string, userID int, email string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(raw)
+
+	err := users.CreateVerificationToken(r.Context(), hashToken(token), userID, email, time.Now().Add(VerificationTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	return n.Send(r.Context(), notify.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Confirm your email address by opening this link:\n%s\n\nThe link expires in %s.", verificationLink(publicURL, token), VerificationTokenTTL),
+	})
+}
+
+// sendPendingVerification issues a link for an updated, unverified email unless one is already outstanding.
+// Failures are only logged: the update itself has succeeded and the user can ask for a resend.
+func sendPendingVerification(r *http.Request, users database.UserStore, n notify.Notifier, publicURL string, userID int, email string) {
+	pending, err := users.HasPendingVerification(r.Context(), userID, email)
+	if err == nil && !pending {
+		err = issueVerification(r, users, n, publicURL, userID, email)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error sending verification email", "user_id", userID, "err", err)
+	}
+}
+
+// VerifyEmail:- Confirms a user's email using the token from the verification link
+func VerifyEmail(users database.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			response.ValidationError(w, r, response.FieldError{Field: "token", Message: "token is required"})
+			return
+		}
+
+		// Consume the token; expired, used or unknown tokens and changed emails are all rejected
+		userID, err := users.VerifyEmail(r.Context(), hashToken(token))
+		if errors.Is(err, database.ErrInvalidToken) {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidToken, "Invalid or expired verification token")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "Error verifying email")
+			return
+		}
+
+		response.JSON(w, http.StatusOK, userAction{ID: userID, Message: "Email verified"})
+	}
+}
+
+// ResendVerification:- Sends a new verification link to an unverified user
+func ResendVerification(users database.UserStore, n notify.Notifier, publicURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := userIDParam(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := users.Get(r.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			response.Error(w, r, http.StatusNotFound, response.CodeNotFound, fmt.Sprintf("User not found with ID %d", id))
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "Error fetching user")
+			return
+		}
+		if user.DeletedAt != nil {
+			response.Error(w, r, http.StatusConflict, response.CodeUserDeactivated, fmt.Sprintf("User with ID %d is deactivated", id))
+			return
+		}
+		if user.EmailVerifiedAt != nil {
+			response.Error(w, r, http.StatusConflict, response.CodeConflict, fmt.Sprintf("Email for user with ID %d is already verified", id))
+			return
+		}
+
+		if err := issueVerification(r, users, n, publicURL, user.ID, user.Email); err != nil {
+			serverError(w, r, err, "Error sending verification email")
+			return
+		}
+
+		response.JSON(w, http.StatusAccepted, userAction{ID: user.ID, Message: "Verification email sent"})
+	}
+}
@@ -0,0 +1,117 @@
+// Package health implements the liveness and readiness endpoints.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet-system/response"
+	database "wallet-system/storage"
+	"wallet-system/worker"
+)
+
+// Check reports whether one dependency of the service is usable; nil means it is.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Component is the readiness of one checked dependency.
+type Component struct {
+	Status    string  `json:"status"` // "ok" or "fail"
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Report is the body of the readiness endpoint.
+type Report struct {
+	Status     string               `json:"status"` // "ready" or "not_ready"
+	Components map[string]Component `json:"components"`
+}
+
+// Live answers liveness probes. It checks nothing beyond the process serving HTTP, so a slow or
+// failed dependency never gets a healthy instance restarted.
+func Live(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready answers readiness probes: it runs every check concurrently, each bounded by timeout, and
+// responds 200 when all pass or 503 otherwise, with the result of each check.
+func Ready(checks []Check, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		report := Report{Status: "ready", Components: make(map[string]Component, len(checks))}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, c := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				err := c.Run(ctx)
+				comp := Component{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+				if err != nil {
+					comp.Status, comp.Error = "fail", err.Error()
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				report.Components[c.Name] = comp
+				if err != nil {
+					report.Status = "not_ready"
+				}
+			}()
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		if report.Status != "ready" {
+			status = http.StatusServiceUnavailable
+		}
+		response.JSON(w, status, report)
+	}
+}
+
+// Database checks that db answers a ping.
+func Database(db *sql.DB) Check {
+	return Check{Name: "database", Run: db.PingContext}
+}
+
+// Migrations checks that every migration embedded in the binary has been applied to db.
+func Migrations(db *sql.DB, driver string) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		pending, err := database.PendingMigrations(ctx, db, driver)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d migration(s) pending", pending)
+		}
+		return nil
+	}}
+}
+
+// Workers checks that every background job of runner is still running.
+func Workers(runner *worker.Runner) Check {
+	return Check{Name: "workers", Run: func(context.Context) error {
+		var stopped []string
+		for name, running := range runner.Running() {
+			if !running {
+				stopped = append(stopped, name)
+			}
+		}
+		if len(stopped) > 0 {
+			sort.Strings(stopped)
+			return fmt.Errorf("not running: %s", strings.Join(stopped, ", "))
+		}
+		return nil
+	}}
+}
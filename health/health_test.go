@@ -0,0 +1,104 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wallet-system/config"
+	database "wallet-system/storage"
+	"wallet-system/worker"
+)
+
+func ready(t *testing.T, checks []Check) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Ready(checks, 50*time.Millisecond)(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, report
+}
+
+func TestReady(t *testing.T) {
+	ok := Check{Name: "ok", Run: func(context.Context) error { return nil }}
+	failing := Check{Name: "failing", Run: func(context.Context) error { return errors.New("boom") }}
+	slow := Check{Name: "slow", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	code, report := ready(t, []Check{ok})
+	if code != http.StatusOK || report.Status != "ready" || report.Components["ok"].Status != "ok" {
+		t.Errorf("all passing: %d %+v", code, report)
+	}
+
+	code, report = ready(t, []Check{ok, failing, slow})
+	if code != http.StatusServiceUnavailable || report.Status != "not_ready" {
+		t.Errorf("with failures: %d %+v", code, report)
+	}
+	if c := report.Components["failing"]; c.Status != "fail" || c.Error != "boom" {
+		t.Errorf("failing component = %+v", c)
+	}
+	if c := report.Components["slow"]; c.Status != "fail" || c.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow component = %+v", c)
+	}
+	if c := report.Components["ok"]; c.Status != "ok" {
+		t.Errorf("ok component = %+v", c)
+	}
+}
+
+func TestDatabaseChecks(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "wallet.db")
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	checks := []Check{Database(db), Migrations(db, "sqlite")}
+	if code, report := ready(t, checks); code != http.StatusServiceUnavailable || report.Components["migrations"].Status != "fail" {
+		t.Errorf("before migrating: %d %+v", code, report)
+	}
+	// Probes only read: they must not create schema_migrations on a database never migrated
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("readiness probe created schema_migrations (%d tables, %v)", tables, err)
+	}
+
+	if _, err := database.MigrateUp(context.Background(), db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if code, report := ready(t, checks); code != http.StatusOK {
+		t.Errorf("after migrating: %d %+v", code, report)
+	}
+
+	db.Close()
+	if code, report := ready(t, checks); code != http.StatusServiceUnavailable || report.Components["database"].Status != "fail" {
+		t.Errorf("after closing: %d %+v", code, report)
+	}
+}
+
+func TestWorkersCheck(t *testing.T) {
+	runner := worker.NewRunner()
+	runner.Every("job", time.Hour, func(context.Context) error { return nil })
+	check := Workers(runner)
+
+	if err := check.Run(context.Background()); err != nil {
+		t.Errorf("running runner: %v", err)
+	}
+	if err := runner.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Run(context.Background()); err == nil {
+		t.Error("stopped runner reported as running")
+	}
+}
@@ -0,0 +1,177 @@
+// Package logging builds the service's structured logger from configuration.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet-system/config"
+)
+
+// New returns a logger writing to w at cfg.Level. Format "json" writes one JSON object per line and
+// "logfmt" writes key=value lines; "text" is logfmt too, but colored when w is a terminal.
+// Records logged with a request context carry its request_id.
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(cfg.Level)}
+	var h slog.Handler
+	switch {
+	case cfg.Format == "json":
+		h = slog.NewJSONHandler(w, opts)
+	case cfg.Format == "text" && isTerminal(w):
+		h = &colorHandler{w: w, mu: &sync.Mutex{}, level: opts.Level}
+	default:
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// ParseLevel maps debug, info, warn or error to its slog level; anything else is info.
+func ParseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// isTerminal reports whether w is a character device such as an interactive terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorHandler writes the same key=value lines as slog.TextHandler, but with a short local time,
+// a colored level and a colored HTTP status, for people watching the server in a terminal.
+type colorHandler struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	level  slog.Leveler
+	prefix string // group prefix for attribute keys, e.g. "db."
+	attrs  []byte // preformatted attributes from WithAttrs
+}
+
+func (h *colorHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *colorHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	buf.WriteString(r.Time.Format("15:04:05.000"))
+	buf.WriteByte(' ')
+	buf.WriteString(colorizeLevel(r.Level))
+	buf.WriteByte(' ')
+	buf.WriteString(r.Message)
+	buf.Write(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&buf, h.prefix, a)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *colorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var buf bytes.Buffer
+	buf.Write(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&buf, h.prefix, a)
+	}
+	h2 := *h
+	h2.attrs = buf.Bytes()
+	return &h2
+}
+
+func (h *colorHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendAttr writes " key=value" for a, flattening groups into dotted keys.
+func appendAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(buf, prefix, ga)
+		}
+		return
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(prefix + a.Key)
+	buf.WriteByte('=')
+	switch {
+	case a.Key == "status" && a.Value.Kind() == slog.KindInt64:
+		buf.WriteString(colorizeStatusCode(int(a.Value.Int64())))
+	case a.Value.Kind() == slog.KindDuration:
+		buf.WriteString(a.Value.Duration().Round(time.Microsecond).String())
+	default:
+		s := a.Value.String()
+		if s == "" || strings.ContainsAny(s, " =\"") || !strconv.CanBackquote(s) {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+}
+
+// colorizeLevel pads the level name and colors warnings and errors.
+func colorizeLevel(level slog.Level) string {
+	name := fmt.Sprintf("%-5s", level.String())
+	switch {
+	case level >= slog.LevelError:
+		return "\033[31m" + name + resetColor()
+	case level >= slog.LevelWarn:
+		return "\033[33m" + name + resetColor()
+	case level < slog.LevelInfo:
+		return "\033[90m" + name + resetColor()
+	}
+	return name
+}
+
+// colorizeStatusCode adds color based on status code
+func colorizeStatusCode(statusCode int) string {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return fmt.Sprintf("\033[32m%d\033[0m", statusCode) // Green for 2xx
+	case statusCode >= 400 && statusCode < 500:
+		return fmt.Sprintf("\033[33m%d\033[0m", statusCode) // Yellow for 4xx
+	case statusCode >= 500:
+		return fmt.Sprintf("\033[31m%d\033[0m", statusCode) // Red for 5xx
+	default:
+		return fmt.Sprintf("%d", statusCode) // Default color
+	}
+}
+
+// resetColor resets ANSI color
+func resetColor() string {
+	return "\033[0m"
+}
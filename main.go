@@ -1,46 +1,275 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
 	// Import package
+	"wallet-system/config"
 	"wallet-system/handlers"
-	"wallet-system/middleware" 
+	"wallet-system/health"
+	"wallet-system/logging"
+	"wallet-system/metrics"
+	"wallet-system/middleware"
+	"wallet-system/notify"
+	"wallet-system/router"
 	database "wallet-system/storage"
-
-	"github.com/gorilla/mux"
+	"wallet-system/tracing"
+	"wallet-system/worker"
 )
 
 func main() {
-	// Connect to the database
-	db := database.Connect()
+	configPath := flag.String("config", "", "path to an optional JSON or YAML config file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-config file] [migrate up|down [n]|status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	switch args := flag.Args(); {
+	case len(args) == 0:
+		err = run(*configPath)
+	case args[0] == "migrate":
+		err = migrate(*configPath, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// migrate runs the migrate subcommand: "up" applies pending migrations, "down [n]" reverts the
+// last n (default 1) and "status" lists every migration.
+func migrate(configPath string, args []string) error {
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[0] != "down") {
+		return errors.New("usage: migrate up | migrate down [n] | migrate status")
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	if cfg.Database.Driver == "memory" {
+		return errors.New("migrate: the memory storage driver has no schema to migrate")
+	}
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		return err
+	}
 	defer db.Close()
 
-	r := mux.NewRouter()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx, db, cfg.Database.Driver)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			log.Println("Database schema is up to date")
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("migrate down: step count must be a positive integer, got %q", args[1])
+			}
+		}
+		reverted, err := database.MigrateDown(ctx, db, cfg.Database.Driver, steps)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			log.Println("No migrations to revert")
+		}
+		return nil
+
+	case "status":
+		states, err := database.MigrationStatus(ctx, db, cfg.Database.Driver)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
+
+// run starts the server and blocks until it has shut down after SIGINT or SIGTERM.
+func run(configPath string) error {
+	// Load configuration: defaults, config file, .env and environment
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	// Structured logging; the standard log package writes through it too
+	slog.SetDefault(logging.New(cfg.Log, os.Stderr))
+
+	// Tracing of requests, store calls and SQL statements
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+
+	// Open the storage backend
+	stores, readiness, closeStores, err := openStores(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+	stores = tracing.Stores(stores)
+	if err := metrics.RegisterWallet(stores.Wallet); err != nil {
+		return err
+	}
+
+	// Notifier used to deliver email verification links
+	notifier, err := notify.New(cfg.Notifier.Kind, cfg.Notifier.File)
+	if err != nil {
+		return err
+	}
 
-	// User-related endpoints
-	r.HandleFunc("/user/create", handlers.CreateUser(db)).Methods("POST")          // Create User
-	r.HandleFunc("/user/{id}/update", handlers.UpdateUser(db)).Methods("PUT")      // Update User by ID
-	r.HandleFunc("/user/{id}/details", handlers.GetUserDetails(db)).Methods("GET") // Get User details by ID
-	r.HandleFunc("/user/{id}/delete", handlers.DeleteUser(db)).Methods("DELETE")   // Get User details by ID
+	// Background jobs
+	workers := worker.NewRunner()
+	workers.Every("verification-token-cleanup", time.Hour, func(ctx context.Context) error {
+		_, err := stores.Users.DeleteStaleVerificationTokens(ctx)
+		return err
+	})
 
-	// Transaction-related endpoints
-	r.HandleFunc("/transaction", handlers.TransactionStart(db)).Methods("POST")                       // Transaction (Debit/Credit)
-	r.HandleFunc("/transactions/user/{id}", handlers.GetTransactions(db)).Methods("GET")              // Get all transactions for user by ID
-	r.HandleFunc("/user/transaction-summary/{id}", handlers.GetTransactionSummary(db)).Methods("GET") // Get transaction summary for user by ID
-	r.HandleFunc("/wallet", handlers.GetWalletDetails(db)).Methods("GET")                             // Get Wallet Details
+	// All endpoints live under /api/v1; the old paths are kept as deprecated aliases
+	inflight := &handlers.InflightTracker{}
+	readiness = append(readiness, health.Workers(workers))
+	r := router.New(router.Dependencies{Config: cfg, Stores: stores, Notifier: notifier, Inflight: inflight, Readiness: readiness})
 
-	// Health check endpoint
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Health check passed")
-	}).Methods("GET")
+	// Wrap router with logging middleware, inside the request ID and span so every line carries them.
+	// CORS and the security headers sit inside it, so preflights and rejected origins are logged too.
+	handler := middleware.SecurityHeaders(cfg.Security, middleware.CORS(cfg.CORS, r))
+	loggedRouter := middleware.RequestID(middleware.Tracing(middleware.LoggingMiddleware(slog.Default(), handler)))
 
-	// Wrap router with logging middleware
-	loggedRouter := middleware.LoggingMiddleware(r)
+	srv := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      loggedRouter,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+	}
 
 	// Start the server
-	log.Println("Server is running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", loggedRouter))
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server is running on %s...", cfg.Server.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	// Wait for a shutdown signal (or for the server to fail on its own)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-serveErr:
+		workers.Stop(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+	log.Println("Shutting down...")
+
+	// Stop accepting connections, then wait for in-flight requests and open wallet transactions
+	shutdownTimeout := time.Duration(cfg.Server.ShutdownTimeout)
+	if err := stopServing(srv, inflight, shutdownTimeout); err != nil {
+		log.Printf("Wallet transactions still open after %s: %v", cfg.Server.ShutdownTimeout, err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := workers.Stop(shutdownCtx); err != nil {
+		log.Printf("Background jobs did not stop in time: %v", err)
+	}
+
+	// Flush the last spans
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Error flushing traces: %v", err)
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Println("Server stopped")
+	return nil
+}
+
+// stopServing stops srv: it waits up to timeout for in-flight requests, then closes the remaining
+// connections. Closing a connection does not stop its handler, so wallet transactions still open
+// get a timeout of their own to commit or roll back before the database pool goes away; the
+// error is non-nil if some are still open after it.
+func stopServing(srv *http.Server, inflight *handlers.InflightTracker, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Requests still running after %s, closing connections: %v", timeout, err)
+		srv.Close()
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), timeout)
+	defer cancelDrain()
+	return inflight.Drain(drainCtx)
+}
+
+// openStores opens the storage backend selected by cfg.Driver. For the SQL drivers it also brings
+// the schema up to date, or warns when it is behind the binary, and returns the readiness checks of
+// the database. The returned function releases the backend.
+func openStores(cfg config.DatabaseConfig) (database.Stores, []health.Check, func() error, error) {
+	if cfg.Driver == "memory" {
+		log.Println("Using in-memory storage; all data is lost when the server stops")
+		return database.NewMemoryStores(), nil, func() error { return nil }, nil
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		return database.Stores{}, nil, nil, err
+	}
+
+	if cfg.AutoMigrate {
+		_, err = database.MigrateUp(context.Background(), db, cfg.Driver)
+	} else if pending, perr := database.PendingMigrations(context.Background(), db, cfg.Driver); perr != nil {
+		err = perr
+	} else if pending > 0 {
+		log.Printf("Warning: %d database migration(s) pending; run `migrate up` or set DB_AUTO_MIGRATE=true", pending)
+	}
+	if err != nil {
+		db.Close()
+		return database.Stores{}, nil, nil, err
+	}
+
+	if err := metrics.RegisterDB(db, cfg.Driver); err != nil {
+		db.Close()
+		return database.Stores{}, nil, nil, err
+	}
+
+	checks := []health.Check{health.Database(db), health.Migrations(db, cfg.Driver)}
+	if cfg.Driver == "sqlite" {
+		return database.NewSQLiteStores(db), checks, db.Close, nil
+	}
+	return database.NewPostgresStores(db), checks, db.Close, nil
 }
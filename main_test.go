@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"wallet-system/config"
+	"wallet-system/handlers"
+	"wallet-system/notify"
+	"wallet-system/router"
+	database "wallet-system/storage"
+)
+
+// holdingWallet parks every Apply until release is closed, as if its commit were still running.
+// The commit then goes ahead even though the request's connection has been closed by then.
+type holdingWallet struct {
+	database.WalletStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (w holdingWallet) Apply(ctx context.Context, e database.WalletEntry) (database.WalletResult, error) {
+	close(w.entered)
+	<-w.release
+	return w.WalletStore.Apply(context.WithoutCancel(ctx), e)
+}
+
+// TestStopServingDrainsOpenTransactions holds a wallet transaction open past the shutdown timeout
+// and checks that stopServing closes the connection, refuses new transactions and then still gives
+// the open one a full timeout to commit.
+func TestStopServingDrainsOpenTransactions(t *testing.T) {
+	stores := database.NewMemoryStores()
+	user, err := stores.Users.Create(context.Background(), database.NewUser{Username: "jdoe", Fname: "John", Lname: "Doe", Email: "j@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := holdingWallet{stores.Wallet, make(chan struct{}), make(chan struct{})}
+	stores.Wallet = wallet
+
+	cfg := config.Default()
+	cfg.Features.RequireEmailVerification = false
+	cfg.RateLimit.Enabled = false
+	inflight := &handlers.InflightTracker{}
+	srv := &http.Server{Handler: router.New(router.Dependencies{Config: cfg, Stores: stores, Notifier: notify.LogNotifier{}, Inflight: inflight})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	posted := make(chan error, 1)
+	go func() {
+		resp, err := http.Post("http://"+ln.Addr().String()+"/api/v1/transactions", "application/json",
+			bytes.NewBufferString(`{"id":1,"username":"jdoe","type":"credit","amount":10}`))
+		if err == nil {
+			resp.Body.Close()
+		}
+		posted <- err
+	}()
+	<-wallet.entered
+
+	const timeout = 200 * time.Millisecond
+	stopped := make(chan error, 1)
+	go func() { stopped <- stopServing(srv, inflight, timeout) }()
+
+	// Draining starts only after the shutdown timeout has run out and the connection is closed
+	for {
+		done, ok := inflight.Start()
+		if !ok {
+			break
+		}
+		done()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := <-posted; err == nil {
+		t.Error("client got a response although its connection was closed at the shutdown timeout")
+	}
+	select {
+	case err := <-stopped:
+		t.Fatalf("stopServing returned %v while a wallet transaction was still open", err)
+	default:
+	}
+
+	close(wallet.release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("stopServing: %v", err)
+	}
+	if list, _ := stores.Transactions.ListByUser(context.Background(), user.ID); len(list) != 1 {
+		t.Errorf("%d transactions recorded, want the one open at shutdown", len(list))
+	}
+}
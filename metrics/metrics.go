@@ -0,0 +1,139 @@
+// Package metrics collects the service's Prometheus metrics and serves them at /metrics.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	database "wallet-system/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the service, plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wallet_http_requests_total",
+		Help: "HTTP requests served, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wallet_http_request_duration_seconds",
+		Help:    "Time to serve HTTP requests, by method, route template and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	walletLockWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wallet_lock_wait_seconds",
+		Help:    "Time a debit or credit waited for the shared wallet lock.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+
+	walletTransactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wallet_transactions_total",
+		Help: "Debits and credits attempted on the shared wallet, by type and outcome.",
+	}, []string{"type", "outcome"})
+
+	walletAmount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wallet_transaction_amount_total",
+		Help: "Sum of the amounts of debits and credits attempted on the shared wallet, by type and outcome.",
+	}, []string{"type", "outcome"})
+)
+
+// Transaction outcomes, the values of the outcome label.
+const (
+	OutcomeCompleted           = "completed"
+	OutcomeInsufficientBalance = "insufficient_balance"
+	OutcomeWalletBusy          = "wallet_busy"
+	OutcomeTimeout             = "timeout" // request deadline passed or client disconnected
+	OutcomeError               = "error"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, walletLockWait, walletTransactions, walletAmount,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// standardMethods are the methods of RFC 9110 and PATCH.
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true,
+	http.MethodTrace: true,
+}
+
+// ObserveHTTPRequest records a served request. route is the route template, so that paths with
+// IDs in them don't each get their own series; pass "" for requests that matched no route.
+// Methods other than the standard ones are recorded as "OTHER" for the same reason: the client
+// chooses the method.
+func ObserveHTTPRequest(method, route string, status int, latency time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	if !standardMethods[method] {
+		method = "OTHER"
+	}
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(latency.Seconds())
+}
+
+// ObserveWalletLockWait records how long a wallet entry waited for the wallet lock.
+func ObserveWalletLockWait(d time.Duration) {
+	walletLockWait.Observe(d.Seconds())
+}
+
+// ObserveWalletTransaction records a debit or credit of amount and its outcome.
+func ObserveWalletTransaction(kind, outcome string, amount float64) {
+	walletTransactions.WithLabelValues(kind, outcome).Inc()
+	walletAmount.WithLabelValues(kind, outcome).Add(amount)
+}
+
+// RegisterDB exports the connection pool statistics of db, labeled with the driver name.
+func RegisterDB(db *sql.DB, driver string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, driver))
+}
+
+// RegisterWallet exports the shared wallet's balance, read from wallet on every scrape.
+func RegisterWallet(wallet database.WalletStore) error {
+	return Registry.Register(&balanceCollector{wallet: wallet})
+}
+
+var balanceDesc = prometheus.NewDesc("wallet_balance", "Current balance of the shared wallet.", nil, nil)
+
+// balanceCollector reads the balance at scrape time, so it is right even when another instance
+// of the service changed it.
+type balanceCollector struct {
+	wallet database.WalletStore
+}
+
+func (c *balanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- balanceDesc
+}
+
+func (c *balanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w, err := c.wallet.Get(ctx)
+	if err != nil {
+		slog.Error("Error reading wallet balance for metrics", "err", err)
+		ch <- prometheus.NewInvalidMetric(balanceDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(balanceDesc, prometheus.GaugeValue, w.Balance)
+}
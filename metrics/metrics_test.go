@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	database "wallet-system/storage"
+)
+
+func TestHandler(t *testing.T) {
+	stores := database.NewMemoryStores()
+	if err := RegisterWallet(stores.Wallet); err != nil {
+		t.Fatal(err)
+	}
+	u, err := stores.Users.Create(context.Background(), database.NewUser{Username: "jdoe", Fname: "John", Lname: "Doe", Email: "j@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stores.Wallet.Apply(context.Background(), database.WalletEntry{
+		UserID: u.ID, UserName: u.Username, Type: "credit", Amount: 12.5,
+		Locked: func() { ObserveWalletLockWait(time.Millisecond) },
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ObserveHTTPRequest("GET", "/api/v1/users/{id}", 200, 20*time.Millisecond)
+	ObserveHTTPRequest("GET", "", 404, time.Millisecond)
+	ObserveHTTPRequest("FOO", "", 405, time.Millisecond)
+	ObserveHTTPRequest("get", "", 405, time.Millisecond)
+	ObserveWalletTransaction("credit", OutcomeCompleted, 12.5)
+	ObserveWalletTransaction("debit", OutcomeInsufficientBalance, 100)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, want := range []string{
+		`wallet_http_requests_total{method="GET",route="/api/v1/users/{id}",status="200"} 1`,
+		`wallet_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`wallet_http_requests_total{method="OTHER",route="unmatched",status="405"} 2`,
+		`wallet_http_request_duration_seconds_count{method="GET",route="/api/v1/users/{id}",status="200"} 1`,
+		`wallet_lock_wait_seconds_count 1`,
+		`wallet_transactions_total{outcome="completed",type="credit"} 1`,
+		`wallet_transaction_amount_total{outcome="insufficient_balance",type="debit"} 100`,
+		`wallet_balance 12.5`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output is missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"wallet-system/response"
+)
+
+// RequireAdmin only lets a request through when its X-Admin-Token header matches token.
+// If token is empty, every admin request is rejected.
+func RequireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := token
+		given := r.Header.Get("X-Admin-Token")
+		if expected == "" || subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+			response.Error(w, r, http.StatusForbidden, response.CodeForbidden, "Admin access required")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -1,63 +1,142 @@
 package middleware
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"wallet-system/metrics"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// LoggingMiddleware logs HTTP requests with status codes, execution time, and color-coded status
-func LoggingMiddleware(next http.Handler) http.Handler {
+// LoggingMiddleware writes one access log entry per request to logger: method, route template,
+// status, bytes written, latency, client IP and the user ID when known. The request ID is added by
+// the logger from the context, so RequestID must run before this middleware.
+// Server errors are logged at error level, client errors at warn and everything else at info.
+// The same measurements feed the HTTP request metrics.
+func LoggingMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// start := time.Now()
+		start := time.Now()
+
+		// The router and handlers fill in what only they know (route, user) through the context
+		entry := &accessEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry))
 
-		// Use a ResponseWriter wrapper to capture the status code
+		// Use a ResponseWriter wrapper to capture the status code and body size
 		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
 
 		// Call the next handler
 		next.ServeHTTP(rec, r)
 
-		// Format log entry
-		// logEntry := fmt.Sprintf(
-		// 	"\t\tStatus: %s %-20s URI:-%-15s\t %-10s\t %s",
-		// 	colorizeStatusCode(rec.statusCode), // Color-coded status
-		// 	r.Method,
-		// 	r.RequestURI,
-		// 	// r.RemoteAddr,
-		// 	time.Since(start),
-		// 	resetColor(),
-		// )
-
-		// // Log the request details
-		// log.Println(logEntry)
+		level := slog.LevelInfo
+		switch {
+		case rec.statusCode >= 500:
+			level = slog.LevelError
+		case rec.statusCode >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", entry.route),
+			slog.Int("status", rec.statusCode),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", clientIP(r)),
+		}
+		if entry.route == "" {
+			attrs[1] = slog.String("path", r.URL.Path) // unmatched; there is no template to group by
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, slog.Int("user_id", entry.userID))
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+		metrics.ObserveHTTPRequest(r.Method, entry.route, rec.statusCode, time.Since(start))
+	})
+}
+
+// accessEntry holds the parts of an access log entry that are only known inside the router.
+type accessEntry struct {
+	route  string
+	userID int
+}
+
+type accessEntryKey struct{}
+
+// SetUserID records the user a request acted on, for handlers that take it from the body
+// rather than the path. The user ID goes into the access log and onto the request's span.
+func SetUserID(ctx context.Context, id int) {
+	if entry, ok := ctx.Value(accessEntryKey{}).(*accessEntry); ok {
+		entry.userID = id
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("user.id", id))
+}
+
+// routeVarPattern matches a mux path variable with a regexp, e.g. {id:[0-9]+}.
+var routeVarPattern = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// RecordRoute is a mux middleware that records the matched route template, and the {id} path
+// variable as the user ID, for LoggingMiddleware and the request's span.
+func RecordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				template = routeVarPattern.ReplaceAllString(template, "{$1}")
+				if entry, ok := r.Context().Value(accessEntryKey{}).(*accessEntry); ok {
+					entry.route = template
+				}
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + template)
+				span.SetAttributes(attribute.String("http.route", template))
+			}
+		}
+		if id, err := strconv.Atoi(mux.Vars(r)["id"]); err == nil {
+			SetUserID(r.Context(), id)
+		}
+		next.ServeHTTP(w, r)
 	})
 }
 
-// responseRecorder is a wrapper to capture the status code
+// clientIP is the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responseRecorder is a wrapper to capture the status code and the number of body bytes written
 type responseRecorder struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
 }
 
 func (rec *responseRecorder) WriteHeader(code int) {
-	rec.statusCode = code
+	if !rec.wroteHeader {
+		rec.statusCode = code
+		rec.wroteHeader = true
+	}
 	rec.ResponseWriter.WriteHeader(code)
 }
 
-// colorizeStatusCode adds color based on status code
-func colorizeStatusCode(statusCode int) string {
-	switch {
-	case statusCode >= 200 && statusCode < 300:
-		return fmt.Sprintf("\033[32m%d\033[0m", statusCode) // Green for 2xx
-	case statusCode >= 400 && statusCode < 500:
-		return fmt.Sprintf("\033[33m%d\033[0m", statusCode) // Yellow for 4xx
-	case statusCode >= 500:
-		return fmt.Sprintf("\033[31m%d\033[0m", statusCode) // Red for 5xx
-	default:
-		return fmt.Sprintf("%d", statusCode) // Default color
-	}
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
 }
 
-// resetColor resets ANSI color
-func resetColor() string {
-	return "\033[0m"
+// Unwrap lets http.ResponseController reach the underlying writer (for Flush, deadlines, ...).
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
 }
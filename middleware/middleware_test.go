@@ -0,0 +1,325 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"wallet-system/config"
+	"wallet-system/logging"
+	"wallet-system/response"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(RecordRoute)
+	r.HandleFunc("/users/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	r.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), 7)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	var out bytes.Buffer
+	h := RequestID(LoggingMiddleware(logging.New(config.LogConfig{Level: "info", Format: "json"}, &out), r))
+
+	tests := []struct {
+		target string
+		want   map[string]interface{}
+	}{
+		{"/users/42", map[string]interface{}{
+			"level": "INFO", "method": "GET", "route": "/users/{id}", "status": 200.0, "bytes": 5.0,
+			"client_ip": "192.0.2.1", "user_id": 42.0, "request_id": "req-1",
+		}},
+		{"/transactions", map[string]interface{}{"level": "ERROR", "route": "/transactions", "status": 500.0, "user_id": 7.0}},
+		{"/nowhere", map[string]interface{}{"level": "WARN", "path": "/nowhere", "status": 404.0}},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.Header.Set("X-Request-ID", "req-1")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: log entry is not JSON: %v (%s)", tt.target, err, out.String())
+		}
+		for k, v := range tt.want {
+			if entry[k] != v {
+				t.Errorf("%s: %s = %v, want %v", tt.target, k, entry[k], v)
+			}
+		}
+		if _, ok := entry["latency"]; !ok {
+			t.Errorf("%s: no latency in %s", tt.target, strings.TrimSpace(out.String()))
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var logged bytes.Buffer
+	logger := logging.New(config.LogConfig{Level: "info", Format: "json"}, &logged)
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "inside handler")
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound, "nope")
+	}))
+
+	tests := []struct {
+		name, sent string
+		keep       bool
+	}{
+		{"client ID is kept", "abc-123", true},
+		{"missing ID is generated", "", false},
+		{"ID with spaces is replaced", "a b", false},
+		{"overlong ID is replaced", strings.Repeat("x", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged.Reset()
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.sent != "" {
+				req.Header.Set("X-Request-ID", tt.sent)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			id := rec.Header().Get("X-Request-ID")
+			if tt.keep && id != tt.sent {
+				t.Fatalf("X-Request-ID = %q, want %q", id, tt.sent)
+			}
+			if !tt.keep && (id == "" || id == tt.sent) {
+				t.Fatalf("X-Request-ID = %q, want a generated ID", id)
+			}
+
+			var body struct {
+				Error response.ErrorBody `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.RequestID != id {
+				t.Errorf("error body request_id = %q, want %q", body.Error.RequestID, id)
+			}
+			var entry map[string]interface{}
+			if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry["request_id"] != id {
+				t.Errorf("log line request_id = %v, want %q", entry["request_id"], id)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	cfg := config.Default().RateLimit
+	cfg.Write = config.RateLimit{Rate: 1, Burst: 2}
+	cfg.Money = config.RateLimit{Rate: 0.5, Burst: 1}
+	cfg.APIKeys = []string{"partner-key"}
+	l := NewRateLimiter(cfg, "admin-secret")
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	write, money := l.Limit(RateClassWrite, ok), l.Limit(RateClassMoney, ok)
+	call := func(h http.HandlerFunc, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	for i, want := range []string{"1", "0"} {
+		rec := call(write)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != want || rec.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Fatalf("request %d: status %d, headers %v", i, rec.Code, rec.Header())
+		}
+	}
+	rec := call(write)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" || rec.Header().Get("X-RateLimit-Reset") != "2" {
+		t.Fatalf("over the limit: status %d, headers %v", rec.Code, rec.Header())
+	}
+	var body struct {
+		Error response.ErrorBody `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Code != response.CodeRateLimited {
+		t.Errorf("429 body = %s (%v)", rec.Body, err)
+	}
+
+	// Classes and clients have buckets of their own
+	if rec := call(money); rec.Code != http.StatusOK {
+		t.Errorf("money after exhausting write: status %d", rec.Code)
+	}
+	if rec := call(write, "X-Admin-Token", "admin-secret"); rec.Code != http.StatusOK {
+		t.Errorf("admin: status %d", rec.Code)
+	}
+	if rec := call(write, "X-API-Key", "partner-key"); rec.Code != http.StatusOK {
+		t.Errorf("API key: status %d", rec.Code)
+	}
+	// An unknown key or an untrusted X-Forwarded-For must not buy a fresh bucket
+	if rec := call(write, "X-API-Key", "made-up"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("unknown API key: status %d", rec.Code)
+	}
+	if rec := call(write, "X-Forwarded-For", "203.0.113.9"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("untrusted X-Forwarded-For: status %d", rec.Code)
+	}
+
+	now = now.Add(time.Second)
+	if rec := call(write); rec.Code != http.StatusOK {
+		t.Errorf("after refill: status %d", rec.Code)
+	}
+	if rec := call(money); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("money half refilled: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Idle buckets are swept once full again
+	now = now.Add(rateLimitSweepInterval)
+	call(write)
+	if n := len(l.buckets); n != 1 {
+		t.Errorf("%d buckets after sweep, want 1", n)
+	}
+}
+
+func TestRateLimiterForwardedFor(t *testing.T) {
+	cfg := config.Default().RateLimit
+	cfg.Write = config.RateLimit{Rate: 1, Burst: 1}
+	cfg.TrustForwardedFor = true
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	call := func(l *RateLimiter, forwardedFor ...string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		for _, v := range forwardedFor {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		rec := httptest.NewRecorder()
+		l.Limit(RateClassWrite, ok)(rec, req)
+		return rec.Code
+	}
+
+	// One proxy: the client is the last entry, whatever the client put in front of it
+	l := NewRateLimiter(cfg, "")
+	for _, tt := range []struct {
+		forwardedFor []string
+		status       int
+	}{
+		{[]string{"198.51.100.7"}, http.StatusOK},
+		{[]string{"198.51.100.7"}, http.StatusTooManyRequests},
+		{[]string{"203.0.113.9, 198.51.100.7"}, http.StatusTooManyRequests},
+		{[]string{"203.0.113.9", "198.51.100.7"}, http.StatusTooManyRequests},
+		{[]string{"198.51.100.8"}, http.StatusOK},
+	} {
+		if got := call(l, tt.forwardedFor...); got != tt.status {
+			t.Errorf("X-Forwarded-For %q: status %d, want %d", tt.forwardedFor, got, tt.status)
+		}
+	}
+
+	// Two proxies: the entry before the inner proxy's; a shorter header falls back to the peer
+	cfg.TrustedProxies = 2
+	l = NewRateLimiter(cfg, "")
+	for _, tt := range []struct {
+		forwardedFor []string
+		status       int
+	}{
+		{[]string{"198.51.100.7, 10.0.0.1"}, http.StatusOK},
+		{[]string{"203.0.113.9, 198.51.100.7, 10.0.0.2"}, http.StatusTooManyRequests},
+		{[]string{"10.0.0.1"}, http.StatusOK},
+		{nil, http.StatusTooManyRequests},
+	} {
+		if got := call(l, tt.forwardedFor...); got != tt.status {
+			t.Errorf("two proxies, X-Forwarded-For %q: status %d, want %d", tt.forwardedFor, got, tt.status)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"https://dashboard.example.com"}
+	cfg.AllowCredentials = true
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	h := CORS(cfg, ok)
+	call := func(method, origin, requestMethod string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/users", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call("OPTIONS", "https://dashboard.example.com", "PATCH")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight: status %d", rec.Code)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://dashboard.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, PATCH, DELETE",
+		"Access-Control-Max-Age":           "600",
+		"Vary":                             "Origin",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("preflight %s = %q, want %q", name, got, want)
+		}
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "If-Match") {
+		t.Errorf("preflight Access-Control-Allow-Headers = %q", rec.Header().Get("Access-Control-Allow-Headers"))
+	}
+
+	rec = call("GET", "https://dashboard.example.com", "")
+	if rec.Body.String() != "ok" || rec.Header().Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" ||
+		!strings.Contains(rec.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID") {
+		t.Errorf("allowed origin: body %q, headers %v", rec.Body, rec.Header())
+	}
+
+	if rec := call("OPTIONS", "https://evil.example.com", "DELETE"); rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight from another origin: status %d, headers %v", rec.Code, rec.Header())
+	}
+	if rec := call("GET", "https://evil.example.com", ""); rec.Body.String() != "ok" || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("request from another origin: body %q, headers %v", rec.Body, rec.Header())
+	}
+	if rec := call("GET", "", ""); rec.Body.String() != "ok" || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("same-origin request: body %q, headers %v", rec.Body, rec.Header())
+	}
+
+	cfg.AllowedOrigins, cfg.AllowCredentials = []string{"*"}, false
+	h = CORS(cfg, ok)
+	if rec := call("GET", "https://anyone.example.com", ""); rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Vary") != "" {
+		t.Errorf("wildcard origin: headers %v", rec.Header())
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rec := httptest.NewRecorder()
+	SecurityHeaders(config.Default().Security, ok).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	for name, want := range map[string]string{
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Content-Security-Policy":   "frame-ancestors 'none'",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	SecurityHeaders(config.SecurityConfig{}, ok).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q with HSTS disabled", got)
+	}
+}
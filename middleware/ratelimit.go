@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wallet-system/config"
+	"wallet-system/response"
+)
+
+// Route classes, each limited by its own bucket per client.
+const (
+	RateClassRead  = "read"
+	RateClassWrite = "write"
+	RateClassMoney = "money"
+)
+
+// rateLimitSweepInterval is how often idle buckets are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter enforces token-bucket limits per client and route class.
+type RateLimiter struct {
+	limits            map[string]config.RateLimit
+	adminToken        string
+	apiKeys           map[string]string // X-API-Key -> bucket key
+	trustForwardedFor bool
+	trustedProxies    int
+	now               func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter for cfg. Requests carrying adminToken are keyed as the admin
+// rather than by IP; an empty adminToken matches nothing.
+func NewRateLimiter(cfg config.RateLimitConfig, adminToken string) *RateLimiter {
+	l := &RateLimiter{
+		limits: map[string]config.RateLimit{
+			RateClassRead:  cfg.Read,
+			RateClassWrite: cfg.Write,
+			RateClassMoney: cfg.Money,
+		},
+		adminToken:        adminToken,
+		apiKeys:           map[string]string{},
+		trustForwardedFor: cfg.TrustForwardedFor,
+		trustedProxies:    cfg.TrustedProxies,
+		now:               time.Now,
+		buckets:           map[string]*tokenBucket{},
+	}
+	for _, k := range cfg.APIKeys {
+		// Bucket keys carry a hash of the API key rather than the key itself
+		sum := sha256.Sum256([]byte(k))
+		l.apiKeys[k] = "key:" + hex.EncodeToString(sum[:8])
+	}
+	return l
+}
+
+// Limit applies the bucket of class to next. Every response carries X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the bucket is full again); a request
+// over the limit gets 429 with Retry-After instead of reaching next.
+func (l *RateLimiter) Limit(class string, next http.HandlerFunc) http.HandlerFunc {
+	limit := l.limits[class]
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, remaining, wait := l.take(class+"|"+l.clientKey(r), limit)
+
+		refill := float64(limit.Burst) - remaining
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(refill/limit.Rate))))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			response.Error(w, r, http.StatusTooManyRequests, response.CodeRateLimited, "Too many requests, retry later")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// take removes a token from the bucket key if it has one. It returns whether it did, the tokens
+// left, and otherwise how long until the next token.
+func (l *RateLimiter) take(key string, limit config.RateLimit) (bool, float64, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, b.tokens, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, b.tokens, 0
+}
+
+// sweep drops buckets that have refilled completely: they behave exactly like new ones.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		class, _, _ := strings.Cut(key, "|")
+		limit := l.limits[class]
+		if b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientKey identifies who a request counts against: the admin, a configured API key, or the
+// client IP.
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if l.adminToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(l.adminToken)) == 1 {
+		return "admin"
+	}
+	if key, ok := l.apiKeys[r.Header.Get("X-API-Key")]; ok {
+		return key
+	}
+	if l.trustForwardedFor {
+		// Count from the right: only the entries our proxies appended can be trusted
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		if n := len(hops) - max(l.trustedProxies, 1); n >= 0 {
+			if ip := net.ParseIP(strings.TrimSpace(hops[n])); ip != nil {
+				return "ip:" + ip.String()
+			}
+		}
+	}
+	return "ip:" + clientIP(r)
+}
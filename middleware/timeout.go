@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Deadline runs next with a request context that ends after timeout, so the database calls it
+// makes are cancelled once the client can no longer be answered in time. The request context
+// already ends when the client disconnects.
+func Deadline(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
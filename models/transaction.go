@@ -11,3 +11,12 @@ type Transaction struct {
 	CreatedAt time.Time `json:"created_at"` // Timestamp of when the transaction occurred
 	Status    string    `json:"status"`     // Status of the transaction (e.g., "completed", "pending", "failed")
 }
+
+// TransactionSummary totals a user's credits and debits.
+type TransactionSummary struct {
+	TotalTransactions   int     `json:"total_transactions"`
+	TotalCredits        int     `json:"total_credits"`
+	TotalCreditedAmount float64 `json:"total_credited_amount"`
+	TotalDebits         int     `json:"total_debits"`
+	TotalDebitedAmount  float64 `json:"total_debited_amount"`
+}
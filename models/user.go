@@ -3,10 +3,14 @@ package models
 import "time"
 
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	CreatedAt time.Time `json:"created_at"`
-	Fname     string    `json:"fname"`
-	Lname     string    `json:"lname"`
-	Email     string    `json:"email"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Fname           string     `json:"fname"`
+	Lname           string     `json:"lname"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"` // Set once the user confirms their email
+	Version         int        `json:"version"`                     // Incremented on every update, exposed as ETag
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`        // Set when the user is deactivated (soft deleted)
+	PurgedAt        *time.Time `json:"purged_at,omitempty"`         // Set when the user's personal data has been anonymized
 }
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is a single notification addressed to a user.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages to users (e.g. email verification links).
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogNotifier writes every message to the standard logger. Meant for local development.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "Notification", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileNotifier appends every message as a JSON line to Path, so tests and developers can read them back.
+type FileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening notification file: %w", err)
+	}
+	defer f.Close()
+
+	entry := struct {
+		Message
+		SentAt time.Time `json:"sent_at"`
+	}{msg, time.Now()}
+	return json.NewEncoder(f).Encode(entry)
+}
+
+// New returns the notifier for kind: "log" (the default) or "file", which writes to path.
+func New(kind, path string) (Notifier, error) {
+	switch kind {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("file notifier requires a path")
+		}
+		return &FileNotifier{Path: path}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q", kind)
+}
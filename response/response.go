@@ -0,0 +1,80 @@
+package response
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"wallet-system/logging"
+)
+
+// Stable, machine-readable error codes. Clients should branch on these rather than on messages.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeForbidden            = "forbidden"
+	CodeConflict             = "conflict"
+	CodeGone                 = "gone"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUsernameTaken        = "username_taken"
+	CodeEmailTaken           = "email_taken"
+	CodeUserDeactivated      = "user_deactivated"
+	CodeUserNotDeactivated   = "user_not_deactivated"
+	CodeEmailUnverified      = "email_unverified"
+	CodeInvalidToken         = "invalid_token"
+	CodeInsufficientBalance  = "insufficient_balance"
+	CodeRateLimited          = "rate_limited"
+	CodeWalletBusy           = "wallet_busy"
+	CodeTimeout              = "timeout"
+	CodeShuttingDown         = "shutting_down"
+	CodeInternal             = "internal_error"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ErrorBody is the payload of every error response, wrapped as {"error": {...}}.
+type ErrorBody struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// JSON writes v as a JSON response body with the given status code.
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// Error writes a JSON error envelope with a stable code, a human-readable message and optional field details.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, message string, details ...FieldError) {
+	JSON(w, status, struct {
+		Error ErrorBody `json:"error"`
+	}{ErrorBody{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: logging.RequestID(r.Context()),
+	}})
+}
+
+// ValidationError writes a 400 validation_failed error listing every rejected field.
+func ValidationError(w http.ResponseWriter, r *http.Request, details ...FieldError) {
+	message := "Request validation failed"
+	if len(details) == 1 {
+		message = details[0].Message
+	}
+	Error(w, r, http.StatusBadRequest, CodeValidationFailed, message, details...)
+}
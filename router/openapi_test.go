@@ -0,0 +1,269 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"wallet-system/config"
+	"wallet-system/notify"
+	"wallet-system/openapi"
+	database "wallet-system/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// spec is the subset of an OpenAPI document the tests need.
+type spec struct {
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas map[string]schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type schema struct {
+	Ref        string            `json:"$ref"`
+	Type       string            `json:"type"`
+	Required   []string          `json:"required"`
+	Properties map[string]schema `json:"properties"`
+	Items      *schema           `json:"items"`
+	Enum       []interface{}     `json:"enum"`
+}
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+	var s spec
+	if err := json.Unmarshal(openapi.Spec, &s); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return s
+}
+
+// muxVarPattern matches a mux path variable with a regexp, e.g. {id:[0-9]+}.
+var muxVarPattern = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// specPath turns a mux path template into the matching OpenAPI path.
+func specPath(template string) string {
+	return muxVarPattern.ReplaceAllString(template, "{$1}")
+}
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	s := loadSpec(t)
+	r := New(Dependencies{Config: config.Default(), Notifier: notify.LogNotifier{}})
+
+	registered := map[string]bool{}
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // path prefixes for subrouters
+		}
+		path := specPath(template)
+		for _, method := range methods {
+			registered[method+" "+path] = true
+			if _, ok := s.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("route %s %s is not described in openapi.json", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, ops := range s.Paths {
+		for method := range ops {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("openapi.json describes %s %s, which is not a registered route", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestResponsesMatchOpenAPISchema(t *testing.T) {
+	s := loadSpec(t)
+	cfg := config.Default()
+	cfg.Admin.Token = "admin-secret"
+	// Every request comes from one client: leave reads and writes room, and let the money bucket
+	// run out on the last transaction below
+	cfg.RateLimit.Read = config.RateLimit{Rate: 1, Burst: 100}
+	cfg.RateLimit.Write = config.RateLimit{Rate: 1, Burst: 100}
+	cfg.RateLimit.Money = config.RateLimit{Rate: 0.001, Burst: 4}
+	r := New(Dependencies{Config: cfg, Stores: database.NewMemoryStores(), Notifier: notify.LogNotifier{}})
+
+	// Requests run in order against one in-memory backend, so later ones see earlier writes
+	tests := []struct {
+		method, target, body string
+		status               int
+		admin                bool // send the admin token
+	}{
+		{"GET", "/health", "", http.StatusOK, false},
+		{"GET", "/livez", "", http.StatusOK, false},
+		{"GET", "/readyz", "", http.StatusOK, false},
+		{"GET", "/openapi.json", "", http.StatusOK, false},
+		{"GET", "/api/v1/users/0", "", http.StatusBadRequest, false},
+		{"GET", "/user/abc/details", "", http.StatusBadRequest, false},
+		{"GET", "/api/v1/users?page=0", "", http.StatusBadRequest, true},
+		{"GET", "/api/v1/users/verify", "", http.StatusBadRequest, false},
+		{"POST", "/api/v1/users", "{", http.StatusBadRequest, false},
+		{"POST", "/api/v1/users", `{"username":"jdoe","fname":"J0hn","lname":"Doe","email":"j@example.com"}`, http.StatusBadRequest, false},
+		{"POST", "/api/v1/users", `{"username":"jdoe","fname":"John","lname":"Doe","email":"j@example.com","admin":true}`, http.StatusBadRequest, false},
+		{"PATCH", "/api/v1/users/1", `{"fname":""}`, http.StatusBadRequest, false},
+		{"POST", "/api/v1/transactions", `{"id":1,"username":"jdoe","type":"refund","amount":-5}`, http.StatusBadRequest, false},
+		{"GET", "/api/v1/users", "", http.StatusForbidden, false},
+		{"POST", "/api/v1/users/1/restore", "", http.StatusForbidden, false},
+		{"POST", "/api/v1/users/1/purge", "", http.StatusForbidden, false},
+
+		{"POST", "/api/v1/users", `{"username":"jdoe","fname":"John","lname":"Doe","email":"J@Example.com"}`, http.StatusCreated, false},
+		{"POST", "/api/v1/users", `{"username":"JDoe","fname":"Jane","lname":"Doe","email":"jane@example.com"}`, http.StatusConflict, false},
+		{"GET", "/api/v1/users/1", "", http.StatusOK, false},
+		{"GET", "/api/v1/users/2", "", http.StatusNotFound, false},
+		{"GET", "/api/v1/users?q=jd&sort=-created_at", "", http.StatusOK, true},
+		{"PATCH", "/api/v1/users/1", `{"fname":"Johnny"}`, http.StatusOK, false},
+		{"PUT", "/api/v1/users/2", `{"username":"jane","fname":"Jane","lname":"Doe","email":"jane@example.com"}`, http.StatusNotFound, false},
+		{"POST", "/api/v1/transactions", `{"id":1,"username":"jdoe","type":"credit","amount":50}`, http.StatusOK, false},
+		{"POST", "/api/v1/transactions", `{"id":1,"username":"jdoe","type":"debit","amount":10}`, http.StatusForbidden, false},
+		{"POST", "/api/v1/transactions", `{"id":1,"username":"someone","type":"credit","amount":10}`, http.StatusNotFound, false},
+		{"POST", "/api/v1/transactions", `{"id":1,"username":"jdoe","type":"credit","amount":1}`, http.StatusTooManyRequests, false},
+		{"GET", "/api/v1/users/1/transactions", "", http.StatusOK, false},
+		{"GET", "/api/v1/users/1/transactions/summary", "", http.StatusOK, false},
+		{"GET", "/api/v1/wallet", "", http.StatusOK, false},
+		{"GET", "/wallet", "", http.StatusOK, false},
+		{"DELETE", "/api/v1/users/1", "", http.StatusOK, false},
+		{"DELETE", "/api/v1/users/1", "", http.StatusConflict, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.admin {
+				req.Header.Set("X-Admin-Token", "admin-secret")
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+
+			var match mux.RouteMatch
+			if !r.Match(req, &match) {
+				t.Fatalf("no route matched")
+			}
+			template, _ := match.Route.GetPathTemplate()
+			op, ok := s.Paths[specPath(template)][strings.ToLower(tt.method)]
+			if !ok {
+				t.Fatalf("%s %s is not described in openapi.json", tt.method, specPath(template))
+			}
+			resp, ok := op.Responses[fmt.Sprint(rec.Code)]
+			if !ok {
+				t.Fatalf("openapi.json does not declare status %d for %s %s", rec.Code, tt.method, specPath(template))
+			}
+			media, ok := resp.Content["application/json"]
+			if !ok {
+				t.Fatalf("openapi.json declares no JSON body for status %d", rec.Code)
+			}
+
+			var body interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if err := validate(s, media.Schema, body, "$"); err != nil {
+				t.Errorf("response does not match schema: %v (body %s)", err, rec.Body)
+			}
+		})
+	}
+}
+
+// validate checks value against sc. It covers the parts of JSON Schema that openapi.json uses;
+// properties not declared on an object with declared properties are rejected to catch drift.
+func validate(s spec, sc schema, value interface{}, at string) error {
+	if sc.Ref != "" {
+		name := strings.TrimPrefix(sc.Ref, "#/components/schemas/")
+		ref, ok := s.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, sc.Ref)
+		}
+		return validate(s, ref, value, at)
+	}
+
+	switch sc.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: want object, got %T", at, value)
+		}
+		for _, name := range sc.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+		if len(sc.Properties) == 0 {
+			return nil
+		}
+		for name, v := range obj {
+			prop, ok := sc.Properties[name]
+			if !ok {
+				return fmt.Errorf("%s: undeclared property %q", at, name)
+			}
+			if err := validate(s, prop, v, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: want array, got %T", at, value)
+		}
+		for i, item := range items {
+			if err := validate(s, *sc.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: want string, got %T", at, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: want number, got %T", at, value)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: want integer, got %v", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: want boolean, got %T", at, value)
+		}
+	}
+
+	if len(sc.Enum) > 0 {
+		for _, e := range sc.Enum {
+			if e == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v is not one of %v", at, value, sc.Enum)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"wallet-system/config"
+	"wallet-system/handlers"
+	"wallet-system/health"
+	"wallet-system/metrics"
+	"wallet-system/middleware"
+	"wallet-system/notify"
+	"wallet-system/openapi"
+	"wallet-system/response"
+	database "wallet-system/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// APIPrefix is the path prefix of the current API version.
+const APIPrefix = "/api/v1"
+
+// route is a single /api/v1 endpoint and, if it predates versioning, the old path it is still served on.
+type route struct {
+	name    string
+	method  string
+	path    string // relative to APIPrefix
+	legacy  string // pre-/api/v1 path, "" if the route has no alias
+	handler http.HandlerFunc
+}
+
+// Dependencies are the services the HTTP handlers are built from.
+type Dependencies struct {
+	Config    *config.Config
+	Stores    database.Stores
+	Notifier  notify.Notifier
+	Inflight  *handlers.InflightTracker // optional; wallet transactions are tracked for shutdown draining
+	Readiness []health.Check            // dependencies GET /readyz checks
+}
+
+// New builds the HTTP router: the resource-oriented /api/v1 surface plus the
+// pre-versioning paths, which keep working but are marked deprecated.
+func New(deps Dependencies) *mux.Router {
+	cfg, notifier := deps.Config, deps.Notifier
+	users, wallet, transactions := deps.Stores.Users, deps.Stores.Wallet, deps.Stores.Transactions
+	adminToken := cfg.Admin.Token
+	inflight := deps.Inflight
+	if inflight == nil {
+		inflight = &handlers.InflightTracker{}
+	}
+
+	routes := []route{
+		// Users
+		{"users.list", "GET", "/users", "", middleware.RequireAdmin(adminToken, handlers.ListUsers(users))},
+		{"users.create", "POST", "/users", "/user/create", handlers.CreateUser(users, notifier, cfg.Server.PublicURL)},
+		{"users.verify", "GET", "/users/verify", "/user/verify", handlers.VerifyEmail(users)},
+		{"users.get", "GET", "/users/{id:[0-9]+}", "/user/{id}/details", handlers.GetUserDetails(users, transactions)},
+		{"users.replace", "PUT", "/users/{id:[0-9]+}", "/user/{id}/update", handlers.UpdateUser(users, notifier, cfg.Server.PublicURL)},
+		{"users.patch", "PATCH", "/users/{id:[0-9]+}", "/user/{id}", handlers.PatchUser(users, notifier, cfg.Server.PublicURL)},
+		{"users.delete", "DELETE", "/users/{id:[0-9]+}", "/user/{id}/delete", handlers.DeleteUser(users)},
+		{"users.verification", "POST", "/users/{id:[0-9]+}/verification", "/user/{id}/verification", handlers.ResendVerification(users, notifier, cfg.Server.PublicURL)},
+		{"users.restore", "POST", "/users/{id:[0-9]+}/restore", "/user/{id}/restore", middleware.RequireAdmin(adminToken, handlers.RestoreUser(users, time.Duration(cfg.Features.UserRestoreWindow)))},
+		{"users.purge", "POST", "/users/{id:[0-9]+}/purge", "/user/{id}/purge", middleware.RequireAdmin(adminToken, handlers.PurgeUser(users))},
+
+		// Transactions
+		{"transactions.create", "POST", "/transactions", "/transaction", handlers.TransactionStart(users, wallet, cfg.Features.RequireEmailVerification, time.Duration(cfg.Database.LockTimeout), inflight)},
+		{"users.transactions", "GET", "/users/{id:[0-9]+}/transactions", "/transactions/user/{id}", handlers.GetTransactions(transactions)},
+		{"users.transactions.summary", "GET", "/users/{id:[0-9]+}/transactions/summary", "/user/transaction-summary/{id}", handlers.GetTransactionSummary(transactions)},
+
+		// Wallets
+		{"wallet.get", "GET", "/wallet", "/wallet", handlers.GetWalletDetails(wallet)},
+	}
+
+	// API requests get a deadline, the route's own if it has one
+	for i, rt := range routes {
+		timeout, ok := cfg.Server.RouteTimeouts[rt.name]
+		if !ok {
+			timeout = cfg.Server.RequestTimeout
+		}
+		if timeout > 0 {
+			routes[i].handler = middleware.Deadline(time.Duration(timeout), rt.handler)
+		}
+	}
+	for name := range cfg.Server.RouteTimeouts {
+		if !slices.ContainsFunc(routes, func(rt route) bool { return rt.name == name }) {
+			slog.Warn("Ignoring timeout of unknown route", "route", name)
+		}
+	}
+
+	// API routes are rate limited per client; a legacy path shares the bucket of its successor
+	if cfg.RateLimit.Enabled {
+		limiter := middleware.NewRateLimiter(cfg.RateLimit, adminToken)
+		for i, rt := range routes {
+			routes[i].handler = limiter.Limit(rateClass(rt), rt.handler)
+		}
+	}
+
+	r := mux.NewRouter()
+	r.Use(middleware.RecordRoute)
+	api := r.PathPrefix(APIPrefix).Subrouter()
+	for _, rt := range routes {
+		api.HandleFunc(rt.path, rt.handler).Methods(rt.method).Name(rt.name)
+	}
+	for _, rt := range routes {
+		if rt.legacy != "" {
+			r.HandleFunc(rt.legacy, deprecated(r, rt.name, rt.handler)).Methods(rt.method)
+		}
+	}
+
+	// Liveness stays cheap; readiness checks the database, migrations and background jobs.
+	// /health predates both and answers like /livez.
+	r.HandleFunc("/livez", health.Live).Methods("GET")
+	r.HandleFunc("/readyz", health.Ready(deps.Readiness, time.Duration(cfg.Server.ReadinessTimeout))).Methods("GET")
+	r.HandleFunc("/health", health.Live).Methods("GET")
+
+	// Prometheus metrics
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Machine-readable description of everything above
+	r.HandleFunc("/openapi.json", openapi.Handler()).Methods("GET")
+
+	// Unknown paths and methods get the same JSON error envelope as the handlers
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.Error(w, r, http.StatusNotFound, response.CodeNotFound, "Route not found")
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.Error(w, r, http.StatusMethodNotAllowed, response.CodeMethodNotAllowed, "Method not allowed")
+	})
+
+	return r
+}
+
+// rateClass is the rate limit class of rt: debits and credits take the shared wallet lock and get
+// the tightest limit, other writes the next, reads the loosest.
+func rateClass(rt route) string {
+	switch {
+	case rt.name == "transactions.create":
+		return middleware.RateClassMoney
+	case rt.method == "GET":
+		return middleware.RateClassRead
+	}
+	return middleware.RateClassWrite
+}
+
+// deprecated serves a legacy path with a Deprecation header and a Link to the /api/v1 route that replaces it.
+func deprecated(r *mux.Router, successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if route := r.Get(successor); route != nil {
+			var pairs []string
+			for k, v := range mux.Vars(req) {
+				pairs = append(pairs, k, v)
+			}
+			if u, err := route.URLPath(pairs...); err == nil {
+				w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", u.Path))
+			}
+		}
+		next(w, req)
+	}
+}
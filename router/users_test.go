@@ -0,0 +1,182 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"wallet-system/config"
+	"wallet-system/notify"
+	"wallet-system/response"
+	database "wallet-system/storage"
+)
+
+// mailbox is a Notifier that keeps every message it is given.
+type mailbox struct {
+	mu   sync.Mutex
+	sent []notify.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg notify.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *mailbox) messages() []notify.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]notify.Message(nil), m.sent...)
+}
+
+// serveUsers returns a router over fresh in-memory stores with an admin token, public URL
+// https://wallet.example.com and one user, jdoe (ID 1), along with the mailbox its emails go to.
+func serveUsers(t *testing.T) (http.Handler, *mailbox) {
+	t.Helper()
+	return serveUsersWith(t, database.NewMemoryStores())
+}
+
+func serveUsersWith(t *testing.T, stores database.Stores) (http.Handler, *mailbox) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Admin.Token = "admin-secret"
+	cfg.Server.PublicURL = "https://wallet.example.com/"
+	cfg.RateLimit.Enabled = false
+	mail := &mailbox{}
+	h := New(Dependencies{Config: cfg, Stores: stores, Notifier: mail})
+	if rec := call(h, "POST", "/api/v1/users", `{"username":"jdoe","fname":"John","lname":"Doe","email":"j@example.com"}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("creating jdoe: status %d (body %s)", rec.Code, rec.Body)
+	}
+	return h, mail
+}
+
+func call(h http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error response.ErrorBody `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %s: %v", rec.Body, err)
+	}
+	return body.Error.Code
+}
+
+func TestRestoreActiveUser(t *testing.T) {
+	h, _ := serveUsers(t)
+	admin := map[string]string{"X-Admin-Token": "admin-secret"}
+
+	rec := call(h, "POST", "/api/v1/users/1/restore", "", admin)
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != response.CodeUserNotDeactivated {
+		t.Fatalf("restoring an active user: status %d (body %s)", rec.Code, rec.Body)
+	}
+
+	call(h, "DELETE", "/api/v1/users/1", "", nil)
+	if rec := call(h, "POST", "/api/v1/users/1/restore", "", admin); rec.Code != http.StatusOK {
+		t.Fatalf("restoring a deactivated user: status %d (body %s)", rec.Code, rec.Body)
+	}
+}
+
+func TestVerificationLinkIgnoresHost(t *testing.T) {
+	h, mail := serveUsers(t)
+
+	req := httptest.NewRequest("POST", "/api/v1/users/1/verification", nil)
+	req.Host = "attacker.example.net"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("resend: status %d (body %s)", rec.Code, rec.Body)
+	}
+
+	sent := mail.messages()
+	if len(sent) != 2 {
+		t.Fatalf("%d emails sent, want 2 (on create and on resend)", len(sent))
+	}
+	for _, msg := range sent {
+		if !strings.Contains(msg.Body, "\nhttps://wallet.example.com/api/v1/users/verify?token=") || strings.Contains(msg.Body, "attacker") {
+			t.Errorf("verification email does not link to the public URL:\n%s", msg.Body)
+		}
+	}
+}
+
+// expiredTokens is a UserStore whose verification tokens always count as expired, so nothing but
+// the handler keeps it from sending a new link.
+type expiredTokens struct {
+	database.UserStore
+}
+
+func (expiredTokens) HasPendingVerification(ctx context.Context, userID int, email string) (bool, error) {
+	return false, nil
+}
+
+func TestVerificationOnlyForChangedEmail(t *testing.T) {
+	stores := database.NewMemoryStores()
+	stores.Users = expiredTokens{stores.Users}
+	h, mail := serveUsersWith(t, stores)
+	emails := func() int { return len(mail.messages()) - 1 } // not counting the one sent on create
+
+	edits := []struct {
+		method, body string
+		want         int
+	}{
+		{"PUT", `{"username":"jdoe","fname":"Johnny","lname":"Doe","email":"j@example.com"}`, 0},
+		{"PUT", `{"username":"jdoe","fname":"John","lname":"Doe","email":"j@example.com"}`, 0},
+		{"PATCH", `{"fname":"Jon"}`, 0},
+		{"PATCH", `{"email":"J@Example.com"}`, 0},
+		{"PUT", `{"username":"jdoe","fname":"John","lname":"Doe","email":"john@example.com"}`, 1},
+		{"PATCH", `{"email":"jd@example.com"}`, 2},
+	}
+	for _, e := range edits {
+		if rec := call(h, e.method, "/api/v1/users/1", e.body, nil); rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status %d (body %s)", e.method, e.body, rec.Code, rec.Body)
+		}
+		if got := emails(); got != e.want {
+			t.Errorf("after %s %s: %d verification emails sent, want %d", e.method, e.body, got, e.want)
+		}
+	}
+}
+
+func TestListUsersRequiresAdmin(t *testing.T) {
+	h, _ := serveUsers(t)
+
+	for _, header := range []map[string]string{nil, {"X-Admin-Token": "wrong"}} {
+		rec := call(h, "GET", "/api/v1/users", "", header)
+		if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "j@example.com") {
+			t.Errorf("listing users with header %v: status %d (body %s)", header, rec.Code, rec.Body)
+		}
+	}
+	rec := call(h, "GET", "/api/v1/users", "", map[string]string{"X-Admin-Token": "admin-secret"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "j@example.com") {
+		t.Errorf("listing users as admin: status %d (body %s)", rec.Code, rec.Body)
+	}
+}
+
+// /users came with /api/v1, so it has no deprecated alias outside it
+func TestListUsersHasNoLegacyPath(t *testing.T) {
+	h, _ := serveUsers(t)
+	admin := map[string]string{"X-Admin-Token": "admin-secret"}
+
+	if rec := call(h, "GET", "/users", "", admin); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /users: status %d, want 404", rec.Code)
+	}
+	if rec := call(h, "GET", "/api/v1/users", "", admin); rec.Header().Get("Deprecation") != "" {
+		t.Errorf("GET /api/v1/users is marked deprecated: %v", rec.Header())
+	}
+}
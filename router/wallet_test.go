@@ -0,0 +1,389 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"wallet-system/config"
+	"wallet-system/handlers"
+	"wallet-system/notify"
+	"wallet-system/response"
+	database "wallet-system/storage"
+)
+
+// The wallet tests drive the full HTTP stack against each storage backend. They check the promise
+// TransactionStart makes under concurrency: the balance never goes negative, every accepted
+// request moves the balance by exactly its amount, and every accepted request records exactly one
+// transaction.
+
+func TestConcurrentWalletTransactionsMemory(t *testing.T) {
+	testConcurrentWalletTransactions(t, database.NewMemoryStores())
+}
+
+func TestConcurrentWalletTransactionsSQLite(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "wallet.db")
+	testConcurrentWalletTransactions(t, database.NewSQLiteStores(openMigrated(t, cfg)))
+}
+
+// TestConcurrentWalletTransactionsPostgres runs against the database described by the usual DB_*
+// variables when WALLET_TEST_POSTGRES=1. Every table is emptied first.
+func TestConcurrentWalletTransactionsPostgres(t *testing.T) {
+	if os.Getenv("WALLET_TEST_POSTGRES") != "1" {
+		t.Skip("set WALLET_TEST_POSTGRES=1 to run against PostgreSQL")
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.Driver = "postgres"
+	db := openMigrated(t, cfg.Database)
+	_, err = db.Exec(`TRUNCATE transactions, email_verification_tokens, users RESTART IDENTITY CASCADE;
+		UPDATE shared_wallet SET balance = 0 WHERE id = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConcurrentWalletTransactions(t, database.NewPostgresStores(db))
+}
+
+func openMigrated(t *testing.T, cfg config.DatabaseConfig) *sql.DB {
+	t.Helper()
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.MigrateUp(context.Background(), db, cfg.Driver); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// walletResponse is the body of a successful POST /api/v1/transactions.
+type walletResponse struct {
+	Transaction struct {
+		TransactionID int     `json:"id"`
+		Type          string  `json:"type"`
+		Amount        float64 `json:"amount"`
+	} `json:"transaction"`
+	Balance float64 `json:"balance"`
+}
+
+func testConcurrentWalletTransactions(t *testing.T, stores database.Stores) {
+	cfg := config.Default()
+	cfg.Features.RequireEmailVerification = false
+	cfg.RateLimit.Enabled = false // every request comes from the same IP
+	srv := httptest.NewServer(New(Dependencies{Config: cfg, Stores: stores, Notifier: notify.LogNotifier{}}))
+	defer srv.Close()
+
+	const users = 4
+	for i := 1; i <= users; i++ {
+		body := fmt.Sprintf(`{"username":"user%d","fname":"Test","lname":"User","email":"user%d@example.com"}`, i, i)
+		if status, resp := post(t, srv, "/api/v1/users", body); status != http.StatusCreated {
+			t.Fatalf("creating user%d: status %d (body %s)", i, status, resp)
+		}
+	}
+	const opening = 100_00 // in cents
+	if status, resp := post(t, srv, "/api/v1/transactions", `{"id":1,"username":"user1","type":"credit","amount":100}`); status != http.StatusOK {
+		t.Fatalf("opening credit: status %d (body %s)", status, resp)
+	}
+
+	// 300 requests: two debits of 0.01-4.99 for every credit of 0.01-2.99, so the wallet runs dry
+	// repeatedly and many debits must be refused. Most cent amounts are not exact in binary floating
+	// point, so the expected balance is kept in integer cents.
+	const requests = 300
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		balance  = int64(opening)    // in cents
+		accepted = map[int]int{1: 1} // user ID -> successful requests, including the opening credit
+		refused  int
+		seen     = map[int]bool{}
+	)
+	for i := 0; i < requests; i++ {
+		user := i%users + 1
+		kind, amount := "debit", int64(i*37%499+1)
+		if i%3 == 0 {
+			kind, amount = "credit", int64(i*53%299+1)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"id":%d,"username":"user%d","type":%q,"amount":%d.%02d}`, user, user, kind, amount/100, amount%100)
+			status, resp := post(t, srv, "/api/v1/transactions", body)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch status {
+			case http.StatusOK:
+				var res walletResponse
+				if err := json.Unmarshal(resp, &res); err != nil {
+					t.Errorf("decoding %s: %v", resp, err)
+					return
+				}
+				if res.Balance < 0 {
+					t.Errorf("%s of %d cents left a negative balance %v", kind, amount, res.Balance)
+				}
+				if got := cents(res.Transaction.Amount); got != amount {
+					t.Errorf("%s of %d cents recorded as %v", kind, amount, res.Transaction.Amount)
+				}
+				if seen[res.Transaction.TransactionID] {
+					t.Errorf("transaction ID %d returned twice", res.Transaction.TransactionID)
+				}
+				seen[res.Transaction.TransactionID] = true
+				if kind == "debit" {
+					amount = -amount
+				}
+				balance += amount
+				accepted[user]++
+			case http.StatusBadRequest:
+				if kind != "debit" {
+					t.Errorf("credit of %d cents refused: %s", amount, resp)
+				}
+				refused++
+			default:
+				t.Errorf("%s of %d cents: status %d (body %s)", kind, amount, status, resp)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+	if refused == 0 {
+		t.Error("no debit was refused; the test did not exercise the overdraft check")
+	}
+
+	var wallet struct {
+		Balance float64 `json:"balance"`
+	}
+	get(t, srv, "/api/v1/wallet", &wallet)
+	if cents(wallet.Balance) != balance || wallet.Balance != float64(balance)/100 {
+		t.Errorf("final balance = %v, want %d cents (the sum of accepted requests)", wallet.Balance, balance)
+	}
+	if wallet.Balance < 0 {
+		t.Errorf("final balance %v is negative", wallet.Balance)
+	}
+
+	// The ledger must add up to the balance to the cent
+	var recorded int64
+	for user := 1; user <= users; user++ {
+		var list []struct {
+			Type   string  `json:"type"`
+			Amount float64 `json:"amount"`
+		}
+		get(t, srv, fmt.Sprintf("/api/v1/users/%d/transactions", user), &list)
+		if len(list) != accepted[user] {
+			t.Errorf("user%d has %d transactions recorded, want %d", user, len(list), accepted[user])
+		}
+		for _, tr := range list {
+			if tr.Type == "debit" {
+				recorded -= cents(tr.Amount)
+			} else {
+				recorded += cents(tr.Amount)
+			}
+		}
+	}
+	if recorded != balance {
+		t.Errorf("recorded transactions add up to %d cents, want the balance of %d", recorded, balance)
+	}
+}
+
+// cents converts an amount from a response to whole cents.
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func TestTransactionAmountLimitsMemory(t *testing.T) {
+	testTransactionAmountLimits(t, database.NewMemoryStores())
+}
+
+func TestTransactionAmountLimitsSQLite(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "wallet.db")
+	testTransactionAmountLimits(t, database.NewSQLiteStores(openMigrated(t, cfg)))
+}
+
+// testTransactionAmountLimits checks that amounts PostgreSQL's NUMERIC(14,2) cannot hold are
+// refused with 400 before they reach the backend, and that the largest and smallest that fit are not.
+func testTransactionAmountLimits(t *testing.T, stores database.Stores) {
+	cfg := config.Default()
+	cfg.Features.RequireEmailVerification = false
+	cfg.RateLimit.Enabled = false
+	srv := httptest.NewServer(New(Dependencies{Config: cfg, Stores: stores, Notifier: notify.LogNotifier{}}))
+	defer srv.Close()
+	if status, resp := post(t, srv, "/api/v1/users", `{"username":"jdoe","fname":"John","lname":"Doe","email":"j@example.com"}`); status != http.StatusCreated {
+		t.Fatalf("creating jdoe: status %d (body %s)", status, resp)
+	}
+
+	for _, tt := range []struct {
+		amount string
+		status int
+	}{
+		{"0.001", http.StatusBadRequest},
+		{"10.005", http.StatusBadRequest},
+		{"1000000000000", http.StatusBadRequest},
+		{"999999999999.999", http.StatusBadRequest},
+		{"1e15", http.StatusBadRequest},
+		{"0.01", http.StatusOK},
+		{"0.1", http.StatusOK},
+		{"999999999999.99", http.StatusOK},
+	} {
+		status, resp := post(t, srv, "/api/v1/transactions", `{"id":1,"username":"jdoe","type":"credit","amount":`+tt.amount+`}`)
+		if status != tt.status {
+			t.Errorf("credit of %s: status %d (body %s), want %d", tt.amount, status, resp, tt.status)
+			continue
+		}
+		if status == http.StatusOK {
+			post(t, srv, "/api/v1/transactions", `{"id":1,"username":"jdoe","type":"debit","amount":`+tt.amount+`}`)
+		}
+	}
+}
+
+// TestWalletLockWaits holds the wallet lock and checks that a transaction queued behind it gives up
+// on its lock timeout, on its route deadline, and when its client disconnects, without recording
+// anything.
+func TestWalletLockWaits(t *testing.T) {
+	dbCfg := config.Default().Database
+	dbCfg.Driver = "sqlite"
+	dbCfg.Path = filepath.Join(t.TempDir(), "wallet.db")
+	stores := database.NewSQLiteStores(openMigrated(t, dbCfg))
+	user, err := stores.Users.Create(context.Background(), database.NewUser{Username: "jdoe", Fname: "John", Lname: "Doe", Email: "j@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked, release := make(chan struct{}), make(chan struct{})
+	held := make(chan error, 1)
+	go func() {
+		_, err := stores.Wallet.Apply(context.Background(), database.WalletEntry{UserID: user.ID, UserName: "jdoe", Type: "credit", Amount: 10, Locked: func() {
+			close(locked)
+			<-release
+		}})
+		held <- err
+	}()
+	<-locked
+
+	serve := func(stores database.Stores, configure func(cfg *config.Config)) (*httptest.Server, *handlers.InflightTracker) {
+		cfg := config.Default()
+		cfg.Features.RequireEmailVerification = false
+		configure(cfg)
+		inflight := &handlers.InflightTracker{}
+		srv := httptest.NewServer(New(Dependencies{Config: cfg, Stores: stores, Notifier: notify.LogNotifier{}, Inflight: inflight}))
+		t.Cleanup(srv.Close)
+		return srv, inflight
+	}
+	const credit = `{"id":1,"username":"jdoe","type":"credit","amount":1}`
+	wantError := func(name string, srv *httptest.Server, status int, code string) {
+		t.Helper()
+		got, body := post(t, srv, "/api/v1/transactions", credit)
+		var resp struct {
+			Error response.ErrorBody `json:"error"`
+		}
+		json.Unmarshal(body, &resp)
+		if got != status || resp.Error.Code != code {
+			t.Errorf("%s: status %d (body %s), want %d %s", name, got, body, status, code)
+		}
+	}
+
+	busy, _ := serve(stores, func(cfg *config.Config) { cfg.Database.LockTimeout = config.Duration(50 * time.Millisecond) })
+	wantError("lock timeout", busy, http.StatusServiceUnavailable, response.CodeWalletBusy)
+
+	deadline, _ := serve(stores, func(cfg *config.Config) {
+		cfg.Database.LockTimeout = 0
+		cfg.Server.RouteTimeouts = map[string]config.Duration{"transactions.create": config.Duration(50 * time.Millisecond)}
+	})
+	wantError("route deadline", deadline, http.StatusServiceUnavailable, response.CodeTimeout)
+
+	// The client disconnects only once its transaction is registered and queued for the lock
+	entered := make(chan struct{})
+	waitingStores := stores
+	waitingStores.Wallet = enteringWallet{stores.Wallet, entered}
+	waiting, inflight := serve(waitingStores, func(cfg *config.Config) { cfg.Database.LockTimeout = 0 })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "POST", waiting.URL+"/api/v1/transactions", bytes.NewBufferString(credit))
+	req.Header.Set("Content-Type", "application/json")
+	disconnected := make(chan error, 1)
+	go func() {
+		resp, err := waiting.Client().Do(req)
+		if err == nil {
+			resp.Body.Close()
+			disconnected <- fmt.Errorf("disconnected client got status %d", resp.StatusCode)
+			return
+		}
+		disconnected <- nil
+	}()
+	<-entered
+	cancel()
+	if err := <-disconnected; err != nil {
+		t.Fatal(err)
+	}
+	// The handler must stop waiting for the lock on its own once the client is gone
+	stopped, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	if err := inflight.Drain(stopped); err != nil {
+		t.Fatal("transaction kept waiting for the lock after its client disconnected")
+	}
+
+	close(release)
+	if err := <-held; err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := stores.Transactions.ListByUser(context.Background(), user.ID); len(list) != 1 {
+		t.Errorf("%d transactions recorded, want only the one holding the lock", len(list))
+	}
+}
+
+// enteringWallet closes entered when Apply is first called, before it waits for the wallet lock.
+type enteringWallet struct {
+	database.WalletStore
+	entered chan struct{}
+}
+
+func (w enteringWallet) Apply(ctx context.Context, e database.WalletEntry) (database.WalletResult, error) {
+	close(w.entered)
+	return w.WalletStore.Apply(ctx, e)
+}
+
+func post(t *testing.T, srv *httptest.Server, path, body string) (int, []byte) {
+	t.Helper()
+	resp, err := srv.Client().Post(srv.URL+path, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Errorf("POST %s: %v", path, err)
+		return 0, nil
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	return resp.StatusCode, buf.Bytes()
+}
+
+func get(t *testing.T, srv *httptest.Server, path string, v interface{}) {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
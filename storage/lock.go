@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// waitLock is a mutex whose waiters can give up, which sync.Mutex does not allow: the SQLite and
+// in-memory wallets use it so a debit or credit queued behind others stops waiting when its
+// request ends or its lock timeout passes.
+type waitLock chan struct{}
+
+func newWaitLock() waitLock {
+	return make(waitLock, 1)
+}
+
+func (l waitLock) Lock() {
+	l <- struct{}{}
+}
+
+func (l waitLock) Unlock() {
+	<-l
+}
+
+// LockContext waits for the lock until ctx ends, returning its error, or until timeout has passed,
+// returning ErrWalletBusy. A timeout of 0 waits for ctx alone.
+func (l waitLock) LockContext(ctx context.Context, timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-expired:
+		return ErrWalletBusy
+	}
+}
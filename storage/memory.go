@@ -0,0 +1,421 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"wallet-system/models"
+)
+
+// memoryData is the state shared by the in-memory stores. A single mutex guards all of it, which
+// also serializes wallet entries the way the PostgreSQL row lock does.
+type memoryData struct {
+	mu           waitLock
+	users        map[int]*models.User
+	nextUserID   int
+	tokens       map[string]*memoryToken
+	balance      int64 // wallet balance in cents
+	walletSince  time.Time
+	transactions []models.Transaction
+}
+
+type memoryToken struct {
+	userID    int
+	email     string
+	expiresAt time.Time
+	usedAt    *time.Time
+}
+
+// NewMemoryStores returns stores that keep everything in process memory, starting from an empty
+// wallet. Data is lost when the process exits; it is meant for tests and local development.
+func NewMemoryStores() Stores {
+	d := &memoryData{
+		mu:          newWaitLock(),
+		users:       map[int]*models.User{},
+		nextUserID:  1,
+		tokens:      map[string]*memoryToken{},
+		walletSince: time.Now(),
+	}
+	return Stores{
+		Users:        &MemoryUsers{d},
+		Wallet:       &MemoryWallet{d},
+		Transactions: &MemoryTransactions{d},
+	}
+}
+
+// MemoryUsers is the in-memory UserStore.
+type MemoryUsers struct {
+	d *memoryData
+}
+
+// conflict returns ErrUsernameTaken or ErrEmailTaken when username or email belongs to a user other
+// than excludeID. The caller holds d.mu.
+func (d *memoryData) conflict(username, email string, excludeID int) error {
+	for id, u := range d.users {
+		if id == excludeID {
+			continue
+		}
+		if username != "" && strings.EqualFold(u.Username, username) {
+			return ErrUsernameTaken
+		}
+	}
+	for id, u := range d.users {
+		if id != excludeID && email != "" && strings.EqualFold(u.Email, email) {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUsers) Create(ctx context.Context, nu NewUser) (models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if err := s.d.conflict(nu.Username, nu.Email, 0); err != nil {
+		return models.User{}, err
+	}
+	u := &models.User{
+		ID:        s.d.nextUserID,
+		Username:  nu.Username,
+		CreatedAt: time.Now(),
+		Fname:     nu.Fname,
+		Lname:     nu.Lname,
+		Email:     nu.Email,
+		Version:   1,
+	}
+	s.d.users[u.ID] = u
+	s.d.nextUserID++
+	return *u, nil
+}
+
+func (s *MemoryUsers) Get(ctx context.Context, id int) (models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return *u, nil
+}
+
+func (s *MemoryUsers) List(ctx context.Context, f UserFilter) ([]models.User, int, error) {
+	less, ok := memoryUserOrder[f.Sort]
+	if f.Sort == "" {
+		less, ok = memoryUserOrder["id"], true
+	}
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown user sort field %q", f.Sort)
+	}
+
+	s.d.mu.Lock()
+	var matches []models.User
+	for _, u := range s.d.users {
+		if memoryUserMatches(u, f) {
+			matches = append(matches, *u)
+		}
+	}
+	s.d.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := &matches[i], &matches[j]
+		if f.Descending {
+			a, b = b, a
+		}
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.ID < b.ID
+	})
+
+	total := len(matches)
+	start := min(f.Offset, total)
+	end := total
+	if f.Limit > 0 {
+		end = min(start+f.Limit, total)
+	}
+	return append([]models.User{}, matches[start:end]...), total, nil
+}
+
+// memoryUserOrder implements the UserSortFields for MemoryUsers.List.
+var memoryUserOrder = map[string]func(a, b *models.User) bool{
+	"id":         func(a, b *models.User) bool { return a.ID < b.ID },
+	"username":   func(a, b *models.User) bool { return strings.ToLower(a.Username) < strings.ToLower(b.Username) },
+	"email":      func(a, b *models.User) bool { return a.Email < b.Email },
+	"created_at": func(a, b *models.User) bool { return a.CreatedAt.Before(b.CreatedAt) },
+}
+
+// memoryUserMatches reports whether u passes the filters of f.
+func memoryUserMatches(u *models.User, f UserFilter) bool {
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		found := false
+		for _, field := range []string{u.Username, u.Fname, u.Lname, u.Email} {
+			if strings.HasPrefix(strings.ToLower(field), q) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	switch {
+	case f.Status == "active" && u.DeletedAt != nil,
+		f.Status == "deleted" && u.DeletedAt == nil,
+		f.Verified != nil && *f.Verified != (u.EmailVerifiedAt != nil),
+		f.CreatedFrom != nil && u.CreatedAt.Before(*f.CreatedFrom),
+		f.CreatedTo != nil && u.CreatedAt.After(*f.CreatedTo):
+		return false
+	}
+	return true
+}
+
+func (s *MemoryUsers) Update(ctx context.Context, id int, changes UserChanges, expectedVersion *int) (models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	if u.DeletedAt != nil {
+		return models.User{}, ErrUserDeactivated
+	}
+
+	var username, email string
+	if changes.Username != nil {
+		username = *changes.Username
+	}
+	if changes.Email != nil {
+		email = *changes.Email
+	}
+	if err := s.d.conflict(username, email, id); err != nil {
+		return models.User{}, err
+	}
+	if expectedVersion != nil && *expectedVersion != u.Version {
+		return models.User{}, ErrVersionMismatch
+	}
+
+	if changes.Username != nil {
+		u.Username = *changes.Username
+	}
+	if changes.Fname != nil {
+		u.Fname = *changes.Fname
+	}
+	if changes.Lname != nil {
+		u.Lname = *changes.Lname
+	}
+	if changes.Email != nil && *changes.Email != u.Email {
+		// A changed email has to be verified again
+		u.Email = *changes.Email
+		u.EmailVerifiedAt = nil
+	}
+	u.Version++
+	return *u, nil
+}
+
+func (s *MemoryUsers) Deactivate(ctx context.Context, id int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u.DeletedAt != nil {
+		return ErrUserDeactivated
+	}
+	now := time.Now()
+	u.DeletedAt = &now
+	return nil
+}
+
+func (s *MemoryUsers) Restore(ctx context.Context, id int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || u.DeletedAt == nil || u.PurgedAt != nil {
+		return ErrNotFound
+	}
+	u.DeletedAt = nil
+	return nil
+}
+
+func (s *MemoryUsers) Purge(ctx context.Context, id int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if u.PurgedAt != nil {
+		return ErrUserPurged
+	}
+
+	now := time.Now()
+	placeholder := fmt.Sprintf("deleted-user-%d", id)
+	u.Username, u.Fname, u.Lname, u.Email = placeholder, "Deleted", "User", placeholder+"@invalid"
+	if u.DeletedAt == nil {
+		u.DeletedAt = &now
+	}
+	u.PurgedAt = &now
+
+	for i := range s.d.transactions {
+		if s.d.transactions[i].UserID == id {
+			s.d.transactions[i].UserName = placeholder
+		}
+	}
+	return nil
+}
+
+func (s *MemoryUsers) CreateVerificationToken(ctx context.Context, tokenHash string, userID int, email string, expiresAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.d.tokens[tokenHash]; ok {
+		return fmt.Errorf("verification token already exists")
+	}
+	s.d.tokens[tokenHash] = &memoryToken{userID: userID, email: email, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryUsers) HasPendingVerification(ctx context.Context, userID int, email string) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range s.d.tokens {
+		if t.userID == userID && t.email == email && t.usedAt == nil && t.expiresAt.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryUsers) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	now := time.Now()
+	t, ok := s.d.tokens[tokenHash]
+	if !ok || t.usedAt != nil || !t.expiresAt.After(now) {
+		return 0, ErrInvalidToken
+	}
+	// Only verify if the user still has the email the token was issued for
+	u, ok := s.d.users[t.userID]
+	if !ok || u.Email != t.email || u.DeletedAt != nil {
+		return 0, ErrInvalidToken
+	}
+	t.usedAt = &now
+	u.EmailVerifiedAt = &now
+	return u.ID, nil
+}
+
+func (s *MemoryUsers) DeleteStaleVerificationTokens(ctx context.Context) (int64, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	cutoff := time.Now().Add(-24 * time.Hour)
+	var n int64
+	for hash, t := range s.d.tokens {
+		if t.expiresAt.Before(cutoff) || (t.usedAt != nil && t.usedAt.Before(cutoff)) {
+			delete(s.d.tokens, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MemoryWallet is the in-memory WalletStore.
+type MemoryWallet struct {
+	d *memoryData
+}
+
+func (s *MemoryWallet) Get(ctx context.Context) (models.SharedWallet, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return models.SharedWallet{Balance: fromCents(s.d.balance), CreatedAt: s.d.walletSince}, nil
+}
+
+func (s *MemoryWallet) Apply(ctx context.Context, e WalletEntry) (WalletResult, error) {
+	if err := s.d.mu.LockContext(ctx, e.LockTimeout); err != nil {
+		return WalletResult{}, err
+	}
+	defer s.d.mu.Unlock()
+	e.locked()
+
+	if err := ctx.Err(); err != nil {
+		return WalletResult{}, err
+	}
+	amount := e.cents()
+	if e.Type == "debit" {
+		if amount > s.d.balance {
+			return WalletResult{}, ErrInsufficientBalance
+		}
+		s.d.balance -= amount
+	} else {
+		s.d.balance += amount
+	}
+
+	t := models.Transaction{
+		TransactionID: len(s.d.transactions) + 1,
+		UserID:        e.UserID,
+		UserName:      e.UserName,
+		Type:          e.Type,
+		Amount:        fromCents(amount),
+		CreatedAt:     time.Now(),
+		Status:        "completed",
+	}
+	s.d.transactions = append(s.d.transactions, t)
+	return WalletResult{Transaction: t, Balance: fromCents(s.d.balance)}, nil
+}
+
+// MemoryTransactions is the in-memory TransactionStore.
+type MemoryTransactions struct {
+	d *memoryData
+}
+
+func (s *MemoryTransactions) ListByUser(ctx context.Context, userID int) ([]models.Transaction, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var list []models.Transaction
+	for _, t := range s.d.transactions {
+		if t.UserID == userID {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+func (s *MemoryTransactions) Summary(ctx context.Context, userID int) (models.TransactionSummary, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var sum models.TransactionSummary
+	var credited, debited int64 // in cents
+	for _, t := range s.d.transactions {
+		if t.UserID != userID {
+			continue
+		}
+		sum.TotalTransactions++
+		if t.Type == "credit" {
+			sum.TotalCredits++
+			credited += toCents(t.Amount)
+		} else {
+			sum.TotalDebits++
+			debited += toCents(t.Amount)
+		}
+	}
+	sum.TotalCreditedAmount, sum.TotalDebitedAmount = fromCents(credited), fromCents(debited)
+	return sum, nil
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the versioned schema migrations of each SQL driver, in migrations/<driver>/,
+// named <version>_<name>.up.sql and <version>_<name>.down.sql. Versions are applied in ascending
+// order and never renumbered.
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationTimestampType is the type of schema_migrations.applied_at for each driver.
+var migrationTimestampType = map[string]string{
+	"postgres": "TIMESTAMPTZ",
+	"sqlite":   "DATETIME",
+}
+
+// migrationTableExists counts the schema_migrations tables visible to each driver, without
+// touching the schema.
+var migrationTableExists = map[string]string{
+	"postgres": "SELECT COUNT(*) FROM pg_catalog.pg_tables WHERE tablename = 'schema_migrations' AND schemaname = ANY (current_schemas(false))",
+	"sqlite":   "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+}
+
+// migrationLockID is the PostgreSQL advisory lock held while migrating, so that several
+// instances starting at once with auto-migrate don't race each other.
+const migrationLockID = 7_238_001
+
+// Migration is one embedded schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration has been applied, and when.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations of driver in version order.
+func Migrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", file)
+		}
+		number, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version number", file)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d: up and down files have different names (%q, %q)", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both an up and a down file are required", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration of driver, each in its own transaction, and returns
+// the versions it applied.
+func MigrateUp(ctx context.Context, db *sql.DB, driver string) ([]int, error) {
+	var applied []int
+	err := withMigrationLock(ctx, db, driver, func(conn *sql.Conn) error {
+		if err := createMigrationTable(ctx, conn, driver); err != nil {
+			return err
+		}
+		states, err := migrationStatus(ctx, conn, driver)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			if s.AppliedAt != nil {
+				continue
+			}
+			if err := runMigration(ctx, conn, s.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)", s.Version, s.Name, time.Now().UTC()); err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", s.Version, s.Name, err)
+			}
+			log.Printf("Applied migration %d_%s", s.Version, s.Name)
+			applied = append(applied, s.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the most recently applied migrations, at most steps of them, and returns
+// the versions it reverted.
+func MigrateDown(ctx context.Context, db *sql.DB, driver string, steps int) ([]int, error) {
+	var reverted []int
+	err := withMigrationLock(ctx, db, driver, func(conn *sql.Conn) error {
+		states, err := migrationStatus(ctx, conn, driver)
+		if err != nil {
+			return err
+		}
+		for i := len(states) - 1; i >= 0 && len(reverted) < steps; i-- {
+			s := states[i]
+			if s.AppliedAt == nil {
+				continue
+			}
+			if err := runMigration(ctx, conn, s.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", s.Version); err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", s.Version, s.Name, err)
+			}
+			log.Printf("Reverted migration %d_%s", s.Version, s.Name)
+			reverted = append(reverted, s.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus lists every embedded migration with the time it was applied, if it was. It only
+// reads: on a database that was never migrated every migration is pending.
+func MigrationStatus(ctx context.Context, db *sql.DB, driver string) ([]MigrationState, error) {
+	return migrationStatus(ctx, db, driver)
+}
+
+// PendingMigrations returns how many embedded migrations have not been applied yet. Like
+// MigrationStatus it only reads, so readiness checks can call it on every probe.
+func PendingMigrations(ctx context.Context, db *sql.DB, driver string) (int, error) {
+	states, err := MigrationStatus(ctx, db, driver)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// createMigrationTable creates schema_migrations if it doesn't exist yet.
+func createMigrationTable(ctx context.Context, conn *sql.Conn, driver string) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER NOT NULL PRIMARY KEY,
+		name       TEXT    NOT NULL,
+		applied_at %s NOT NULL
+	)`, migrationTimestampType[driver]))
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// migrationQuerier is the part of *sql.DB and *sql.Conn that migrationStatus needs.
+type migrationQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// migrationStatus matches the rows of schema_migrations against the embedded migrations; without
+// the table, nothing has been applied. A version recorded in the database but missing from the
+// binary is an error: the binary is older than the schema.
+func migrationStatus(ctx context.Context, q migrationQuerier, driver string) ([]MigrationState, error) {
+	migrations, err := Migrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := map[int]time.Time{}
+	var tables int
+	if err := q.QueryRowContext(ctx, migrationTableExists[driver]).Scan(&tables); err != nil {
+		return nil, fmt.Errorf("looking for schema_migrations: %w", err)
+	}
+	if tables > 0 {
+		if err := readAppliedMigrations(ctx, q, appliedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].Migration = m
+		if at, ok := appliedAt[m.Version]; ok {
+			states[i].AppliedAt = &at
+			delete(appliedAt, m.Version)
+		}
+	}
+	for version := range appliedAt {
+		return nil, fmt.Errorf("database has migration %d applied, which this binary does not know about", version)
+	}
+	return states, nil
+}
+
+// readAppliedMigrations adds the version and time of every row of schema_migrations to appliedAt.
+func readAppliedMigrations(ctx context.Context, q migrationQuerier, appliedAt map[int]time.Time) error {
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return err
+		}
+		appliedAt[version] = at
+	}
+	return rows.Err()
+}
+
+// runMigration executes script and the schema_migrations bookkeeping statement in one transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withMigrationLock runs fn on a single connection holding the migration lock. On PostgreSQL that
+// is an advisory lock; SQLite already allows only one writer, and each migration runs in a write
+// transaction.
+func withMigrationLock(ctx context.Context, db *sql.DB, driver string, fn func(*sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if driver != "postgres" {
+		return fn(conn)
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	return fn(conn)
+}
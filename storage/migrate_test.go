@@ -0,0 +1,119 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"wallet-system/config"
+	database "wallet-system/storage"
+)
+
+// TestMigrateAdoptsLegacyPostgresSchema replaces the database described by the usual DB_*
+// variables, when WALLET_TEST_POSTGRES=1, with the tables the service used before it had
+// migrations, and checks that migrating keeps their rows.
+func TestMigrateAdoptsLegacyPostgresSchema(t *testing.T) {
+	if os.Getenv("WALLET_TEST_POSTGRES") != "1" {
+		t.Skip("set WALLET_TEST_POSTGRES=1 to run against PostgreSQL")
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.Driver = "postgres"
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	_, err = db.Exec(`DROP TABLE IF EXISTS schema_migrations, email_verification_tokens, transactions, shared_wallet, users;
+		CREATE TABLE users (
+			id SERIAL PRIMARY KEY, username VARCHAR(50) NOT NULL, fname VARCHAR(100) NOT NULL,
+			lname VARCHAR(100) NOT NULL, email VARCHAR(254) NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT NOW());
+		CREATE TABLE shared_wallet (id INTEGER PRIMARY KEY, balance NUMERIC(14,2) NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT NOW());
+		CREATE TABLE transactions (
+			transaction_id SERIAL PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users (id), user_name VARCHAR(50) NOT NULL,
+			type VARCHAR(10) NOT NULL, amount NUMERIC(14,2) NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT NOW());
+		INSERT INTO users (username, fname, lname, email) VALUES ('jdoe', 'John', 'Doe', 'j@example.com');
+		INSERT INTO shared_wallet (id, balance) VALUES (1, 12.5);
+		INSERT INTO transactions (user_id, user_name, type, amount) VALUES (1, 'jdoe', 'credit', 12.5)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.MigrateUp(ctx, db, "postgres"); err != nil {
+		t.Fatalf("migrating the legacy schema: %v", err)
+	}
+	if pending, err := database.PendingMigrations(ctx, db, "postgres"); err != nil || pending != 0 {
+		t.Fatalf("%d migrations pending after MigrateUp (%v)", pending, err)
+	}
+
+	stores := database.NewPostgresStores(db)
+	user, err := stores.Users.Get(ctx, 1)
+	if err != nil || user.Username != "jdoe" || user.Version != 1 {
+		t.Errorf("legacy user after migrating = %+v (%v)", user, err)
+	}
+	if wallet, err := stores.Wallet.Get(ctx); err != nil || wallet.Balance != 12.5 {
+		t.Errorf("legacy wallet after migrating = %+v (%v)", wallet, err)
+	}
+	if list, err := stores.Transactions.ListByUser(ctx, 1); err != nil || len(list) != 1 {
+		t.Errorf("legacy transactions after migrating = %v (%v)", list, err)
+	}
+	if _, err := db.Exec(`INSERT INTO transactions (user_id, user_name, type, amount) VALUES (1, 'jdoe', 'refund', 1)`); err == nil {
+		t.Error("the type check was not added to the legacy transactions table")
+	}
+}
+
+// TestMigrateSQLiteAmountsToCents writes amounts in the REAL columns of the SQLite schema before
+// migration 3 and checks that they come out to the cent after it, and back again after reverting.
+func TestMigrateSQLiteAmountsToCents(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "wallet.db")
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := database.MigrateUp(ctx, db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateDown(ctx, db, "sqlite", 1); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO users (username, fname, lname, email, created_at) VALUES ('jdoe', 'John', 'Doe', 'j@example.com', '2024-01-01 00:00:00+00:00');
+		UPDATE shared_wallet SET balance = 0.3 - 0.1 WHERE id = 1;
+		INSERT INTO transactions (user_id, user_name, type, amount, created_at) VALUES
+			(1, 'jdoe', 'credit', 0.1 + 0.2, '2024-01-01 00:00:00+00:00'),
+			(1, 'jdoe', 'debit', 0.1, '2024-01-01 00:00:00+00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.MigrateUp(ctx, db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	stores := database.NewSQLiteStores(db)
+	if w, err := stores.Wallet.Get(ctx); err != nil || w.Balance != 0.2 {
+		t.Errorf("wallet after migrating = %+v (%v), want a balance of 0.2", w, err)
+	}
+	if sum, err := stores.Transactions.Summary(ctx, 1); err != nil || sum.TotalCreditedAmount != 0.3 || sum.TotalDebitedAmount != 0.1 {
+		t.Errorf("summary after migrating = %+v (%v)", sum, err)
+	}
+	if res, err := stores.Wallet.Apply(ctx, database.WalletEntry{UserID: 1, UserName: "jdoe", Type: "credit", Amount: 1}); err != nil || res.Transaction.TransactionID != 3 {
+		t.Errorf("credit after migrating = %+v (%v), want transaction 3", res, err)
+	}
+
+	if _, err := database.MigrateDown(ctx, db, "sqlite", 1); err != nil {
+		t.Fatal(err)
+	}
+	var balance float64
+	if err := db.QueryRow("SELECT balance FROM shared_wallet WHERE id = 1").Scan(&balance); err != nil || balance != 1.2 {
+		t.Errorf("balance after reverting = %v (%v), want 1.2", balance, err)
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS shared_wallet;
+DROP TABLE IF EXISTS users;
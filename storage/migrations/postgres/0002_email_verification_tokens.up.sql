@@ -0,0 +1,10 @@
+-- Only the SHA-256 hash of a verification token is stored; the token itself is only ever in the emailed link.
+CREATE TABLE email_verification_tokens (
+    token_hash VARCHAR(64)  PRIMARY KEY,
+    user_id    INTEGER      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      VARCHAR(254) NOT NULL,
+    expires_at TIMESTAMPTZ  NOT NULL,
+    used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens (user_id);
@@ -0,0 +1,39 @@
+-- Timestamps are written by the application as UTC text ("2006-01-02 15:04:05.999999999+00:00"),
+-- which sorts and compares correctly as a string; the DATETIME type makes the driver read them
+-- back as time.Time.
+CREATE TABLE users (
+    id                INTEGER  PRIMARY KEY AUTOINCREMENT,
+    username          TEXT     NOT NULL,
+    fname             TEXT     NOT NULL,
+    lname             TEXT     NOT NULL,
+    email             TEXT     NOT NULL,
+    created_at        DATETIME NOT NULL,
+    email_verified_at DATETIME,
+    version           INTEGER  NOT NULL DEFAULT 1,
+    deleted_at        DATETIME,
+    purged_at         DATETIME
+);
+
+-- Usernames and emails are unique regardless of case; the store maps these index names to conflicts.
+CREATE UNIQUE INDEX users_username_lower_idx ON users (LOWER(username));
+CREATE UNIQUE INDEX users_email_lower_idx ON users (LOWER(email));
+CREATE INDEX users_created_at_idx ON users (created_at);
+
+CREATE TABLE shared_wallet (
+    id         INTEGER  PRIMARY KEY CHECK (id = 1),
+    balance    REAL     NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    created_at DATETIME NOT NULL
+);
+
+INSERT INTO shared_wallet (id, balance, created_at) VALUES (1, 0, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+
+CREATE TABLE transactions (
+    transaction_id INTEGER  PRIMARY KEY AUTOINCREMENT,
+    user_id        INTEGER  NOT NULL REFERENCES users (id),
+    user_name      TEXT     NOT NULL,
+    type           TEXT     NOT NULL CHECK (type IN ('debit', 'credit')),
+    amount         REAL     NOT NULL CHECK (amount > 0),
+    created_at     DATETIME NOT NULL
+);
+
+CREATE INDEX transactions_user_id_idx ON transactions (user_id);
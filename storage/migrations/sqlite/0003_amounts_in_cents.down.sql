@@ -0,0 +1,27 @@
+CREATE TABLE shared_wallet_real (
+    id         INTEGER  PRIMARY KEY CHECK (id = 1),
+    balance    REAL     NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    created_at DATETIME NOT NULL
+);
+
+INSERT INTO shared_wallet_real (id, balance, created_at)
+SELECT id, balance_cents / 100.0, created_at FROM shared_wallet;
+
+DROP TABLE shared_wallet;
+ALTER TABLE shared_wallet_real RENAME TO shared_wallet;
+
+CREATE TABLE transactions_real (
+    transaction_id INTEGER  PRIMARY KEY AUTOINCREMENT,
+    user_id        INTEGER  NOT NULL REFERENCES users (id),
+    user_name      TEXT     NOT NULL,
+    type           TEXT     NOT NULL CHECK (type IN ('debit', 'credit')),
+    amount         REAL     NOT NULL CHECK (amount > 0),
+    created_at     DATETIME NOT NULL
+);
+
+INSERT INTO transactions_real (transaction_id, user_id, user_name, type, amount, created_at)
+SELECT transaction_id, user_id, user_name, type, amount_cents / 100.0, created_at FROM transactions;
+
+DROP TABLE transactions;
+ALTER TABLE transactions_real RENAME TO transactions;
+CREATE INDEX transactions_user_id_idx ON transactions (user_id);
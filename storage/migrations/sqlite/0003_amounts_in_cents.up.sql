@@ -0,0 +1,30 @@
+-- REAL can't hold most amounts exactly, so balances drifted from the sum of their transactions.
+-- Money is kept in whole cents instead. SQLite can't change a column's type, so both tables are
+-- rebuilt; rounding to the cent gives what NUMERIC(14,2) would have stored.
+CREATE TABLE shared_wallet_cents (
+    id            INTEGER  PRIMARY KEY CHECK (id = 1),
+    balance_cents INTEGER  NOT NULL DEFAULT 0 CHECK (balance_cents >= 0),
+    created_at    DATETIME NOT NULL
+);
+
+INSERT INTO shared_wallet_cents (id, balance_cents, created_at)
+SELECT id, CAST(ROUND(balance * 100) AS INTEGER), created_at FROM shared_wallet;
+
+DROP TABLE shared_wallet;
+ALTER TABLE shared_wallet_cents RENAME TO shared_wallet;
+
+CREATE TABLE transactions_cents (
+    transaction_id INTEGER  PRIMARY KEY AUTOINCREMENT,
+    user_id        INTEGER  NOT NULL REFERENCES users (id),
+    user_name      TEXT     NOT NULL,
+    type           TEXT     NOT NULL CHECK (type IN ('debit', 'credit')),
+    amount_cents   INTEGER  NOT NULL CHECK (amount_cents > 0),
+    created_at     DATETIME NOT NULL
+);
+
+INSERT INTO transactions_cents (transaction_id, user_id, user_name, type, amount_cents, created_at)
+SELECT transaction_id, user_id, user_name, type, CAST(ROUND(amount * 100) AS INTEGER), created_at FROM transactions;
+
+DROP TABLE transactions;
+ALTER TABLE transactions_cents RENAME TO transactions;
+CREATE INDEX transactions_user_id_idx ON transactions (user_id);
@@ -1,43 +1,89 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"time"
+
+	"wallet-system/config"
 
 	_ "github.com/lib/pq"
-	"github.com/joho/godotenv"
 )
 
-func Connect() *sql.DB {	
-	// Load .env file
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+// Connect opens the SQL database selected by cfg.Driver ("postgres" or "sqlite") and waits for it
+// to answer a ping. While PostgreSQL is still starting, pings are retried with exponential backoff
+// for up to cfg.ConnectTimeout before giving up.
+func Connect(cfg config.DatabaseConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case "postgres":
+		return connectPostgres(cfg)
+	case "sqlite":
+		return connectSQLite(cfg)
 	}
+	return nil, fmt.Errorf("storage driver %q does not use a SQL database", cfg.Driver)
+}
 
-	// Create the connection string from environment variables
-	connStr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("SSL_MODE"))
+// connectPostgres opens the PostgreSQL pool described by cfg.
+func connectPostgres(cfg config.DatabaseConfig) (*sql.DB, error) {
+	// Create the connection string from the configuration
+	connStr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%d sslmode=%s",
+		cfg.User,
+		cfg.Password,
+		cfg.Name,
+		cfg.Host,
+		cfg.Port,
+		cfg.SSLMode)
 
 	// Connect to PostgreSQL database
-	db, err := sql.Open("postgres", connStr)
+	db, err := openTraced("postgres", connStr, "postgresql")
 	if err != nil {
-		log.Fatalf("Error connecting to the database: %v", err)
+		return nil, fmt.Errorf("opening database: %w", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime))
 
-	// Verify the connection
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Error pinging database: %v", err)
+	// Verify the connection, waiting for the database to come up
+	if err := waitForDatabase(db, time.Duration(cfg.ConnectTimeout)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("pinging database: %w", err)
 	}
 
 	log.Println("Successfully connected to the database")
-	return db
+	return db, nil
+}
+
+// NewPostgresStores returns the PostgreSQL implementation of every store, sharing the pool db.
+func NewPostgresStores(db *sql.DB) Stores {
+	return Stores{
+		Users:        &PostgresUsers{db: db},
+		Wallet:       &PostgresWallet{db: db},
+		Transactions: &PostgresTransactions{db: db},
+	}
+}
+
+// waitForDatabase pings db until it answers or timeout has passed.
+func waitForDatabase(db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	delay := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+		}
+
+		log.Printf("Database not ready (attempt %d), retrying in %s: %v", attempt, delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > 5*time.Second {
+			delay = 5 * time.Second
+		}
+	}
 }
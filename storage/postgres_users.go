@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"wallet-system/models"
+
+	"github.com/lib/pq"
+)
+
+// PostgresUsers is the PostgreSQL UserStore.
+type PostgresUsers struct {
+	db *sql.DB
+}
+
+// uniqueViolation maps a unique-index violation on users to ErrUsernameTaken or ErrEmailTaken and
+// returns any other error unchanged. It covers the race where two requests pass findConflict at once.
+func uniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "users_username_lower_idx":
+		return ErrUsernameTaken
+	case "users_email_lower_idx":
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (s *PostgresUsers) Create(ctx context.Context, u NewUser) (models.User, error) {
+	if err := findUserConflict(ctx, s.db, u.Username, u.Email, 0); err != nil {
+		return models.User{}, err
+	}
+
+	query := `INSERT INTO users (username, fname, lname, email) VALUES ($1, $2, $3, $4) RETURNING ` + userColumns
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, u.Username, u.Fname, u.Lname, u.Email))
+	return user, uniqueViolation(err)
+}
+
+func (s *PostgresUsers) Get(ctx context.Context, id int) (models.User, error) {
+	var user models.User
+	err := RetryRead(ctx, func() (err error) {
+		user, err = getUser(ctx, s.db, id)
+		return err
+	})
+	return user, err
+}
+
+func (s *PostgresUsers) List(ctx context.Context, f UserFilter) ([]models.User, int, error) {
+	return listUsers(ctx, s.db, f, "ILIKE")
+}
+
+func (s *PostgresUsers) Update(ctx context.Context, id int, changes UserChanges, expectedVersion *int) (models.User, error) {
+	// Check the user exists and is still active
+	current, err := s.Get(ctx, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if current.DeletedAt != nil {
+		return models.User{}, ErrUserDeactivated
+	}
+
+	// Reject a username or email that belongs to another user
+	var username, email string
+	if changes.Username != nil {
+		username = *changes.Username
+	}
+	if changes.Email != nil {
+		email = *changes.Email
+	}
+	if username != "" || email != "" {
+		if err := findUserConflict(ctx, s.db, username, email, id); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	// Apply the update, bumping the version. No row matches on a version mismatch, or when another
+	// request deactivated or removed the user since the check above.
+	query, args := userUpdateSQL(id, changes, expectedVersion)
+	query += " RETURNING " + userColumns
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return models.User{}, updateMissError(ctx, s.db, id, expectedVersion)
+	}
+	return user, uniqueViolation(err)
+}
+
+func (s *PostgresUsers) Deactivate(ctx context.Context, id int) error {
+	// The row stays so transaction history keeps resolving
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+		return ErrUserDeactivated
+	}
+	return nil
+}
+
+func (s *PostgresUsers) Restore(ctx context.Context, id int) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL AND purged_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresUsers) Purge(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so a concurrent restore or update can't interleave
+	var purgedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, "SELECT purged_at FROM users WHERE id = $1 FOR UPDATE", id).Scan(&purgedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if purgedAt.Valid {
+		return ErrUserPurged
+	}
+
+	placeholder := fmt.Sprintf("deleted-user-%d", id)
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users
+		SET username = $1, fname = 'Deleted', lname = 'User', email = $2,
+			deleted_at = COALESCE(deleted_at, NOW()), purged_at = NOW()
+		WHERE id = $3`,
+		placeholder, placeholder+"@invalid", id,
+	)
+	if err != nil {
+		return fmt.Errorf("anonymizing user: %w", err)
+	}
+
+	// Transactions carry a copy of the username; replace it but keep amounts and user_id intact
+	_, err = tx.ExecContext(ctx, "UPDATE transactions SET user_name = $1 WHERE user_id = $2", placeholder, id)
+	if err != nil {
+		return fmt.Errorf("anonymizing transactions: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresUsers) CreateVerificationToken(ctx context.Context, tokenHash string, userID int, email string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO email_verification_tokens (token_hash, user_id, email, expires_at) VALUES ($1, $2, $3, $4)",
+		tokenHash, userID, email, expiresAt,
+	)
+	return err
+}
+
+func (s *PostgresUsers) HasPendingVerification(ctx context.Context, userID int, email string) (bool, error) {
+	var pending bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM email_verification_tokens
+			WHERE user_id = $1 AND email = $2 AND used_at IS NULL AND expires_at > NOW())`,
+		userID, email,
+	).Scan(&pending)
+	return pending, err
+}
+
+func (s *PostgresUsers) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Consume the token; expired, used or unknown tokens match no row
+	var userID int
+	var email string
+	err = tx.QueryRowContext(ctx,
+		`UPDATE email_verification_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email`,
+		tokenHash,
+	).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("consuming verification token: %w", err)
+	}
+
+	// Only verify if the user still has the email the token was issued for
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email = $2 AND deleted_at IS NULL",
+		userID, email,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, ErrInvalidToken
+	}
+
+	return userID, tx.Commit()
+}
+
+func (s *PostgresUsers) DeleteStaleVerificationTokens(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM email_verification_tokens
+		WHERE expires_at < NOW() - INTERVAL '1 day' OR used_at < NOW() - INTERVAL '1 day'`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"wallet-system/models"
+
+	"github.com/lib/pq"
+)
+
+// PostgresWallet is the PostgreSQL WalletStore.
+type PostgresWallet struct {
+	db *sql.DB
+}
+
+func (s *PostgresWallet) Get(ctx context.Context) (models.SharedWallet, error) {
+	var wallet models.SharedWallet
+	err := RetryRead(ctx, func() error {
+		return s.db.QueryRowContext(ctx, "SELECT balance, created_at FROM shared_wallet WHERE id = 1").Scan(&wallet.Balance, &wallet.CreatedAt)
+	})
+	return wallet, err
+}
+
+// Apply locks the wallet row with SELECT ... FOR UPDATE, so concurrent entries queue behind each other
+// and every debit sees the balance left by the previous one. The wait is bounded by lock_timeout.
+func (s *PostgresWallet) Apply(ctx context.Context, e WalletEntry) (WalletResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return WalletResult{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// SET takes no bind parameters; LOCAL scopes the setting to this transaction
+	if e.LockTimeout > 0 {
+		ms := max(e.LockTimeout.Milliseconds(), 1) // 0 would disable the timeout
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL lock_timeout = %d", ms)); err != nil {
+			return WalletResult{}, fmt.Errorf("setting lock timeout: %w", err)
+		}
+	}
+
+	// Lock the shared wallet row
+	var balance float64
+	if err := tx.QueryRowContext(ctx, "SELECT balance FROM shared_wallet WHERE id = 1 FOR UPDATE").Scan(&balance); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "55P03" { // lock_not_available
+			return WalletResult{}, ErrWalletBusy
+		}
+		return WalletResult{}, fmt.Errorf("locking wallet: %w", err)
+	}
+	e.locked()
+
+	// Perform the transaction logic: Debit or Credit
+	delta := e.Amount
+	if e.Type == "debit" {
+		if e.Amount > balance {
+			return WalletResult{}, ErrInsufficientBalance
+		}
+		delta = -e.Amount
+	}
+	err = tx.QueryRowContext(ctx, "UPDATE shared_wallet SET balance = balance + $1 WHERE id = 1 RETURNING balance", delta).Scan(&balance)
+	if err != nil {
+		return WalletResult{}, fmt.Errorf("updating balance: %w", err)
+	}
+
+	// Log the transaction (Insert into the transactions table)
+	t := models.Transaction{UserID: e.UserID, UserName: e.UserName, Type: e.Type, Amount: e.Amount, Status: "completed"}
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO transactions (user_id, user_name, type, amount) VALUES ($1, $2, $3, $4) RETURNING transaction_id, created_at",
+		e.UserID, e.UserName, e.Type, e.Amount,
+	).Scan(&t.TransactionID, &t.CreatedAt)
+	if err != nil {
+		return WalletResult{}, fmt.Errorf("recording transaction: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WalletResult{}, fmt.Errorf("committing transaction: %w", err)
+	}
+	return WalletResult{Transaction: t, Balance: balance}, nil
+}
+
+// postgresAmount reads the NUMERIC(14,2) amounts of the PostgreSQL schema as they are.
+var postgresAmount = amountColumn{column: "amount"}
+
+// PostgresTransactions is the PostgreSQL TransactionStore.
+type PostgresTransactions struct {
+	db *sql.DB
+}
+
+func (s *PostgresTransactions) ListByUser(ctx context.Context, userID int) ([]models.Transaction, error) {
+	return listTransactions(ctx, s.db, postgresAmount, userID)
+}
+
+func (s *PostgresTransactions) Summary(ctx context.Context, userID int) (models.TransactionSummary, error) {
+	return transactionSummary(ctx, s.db, postgresAmount, userID)
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// readAttempts is how many times RetryRead runs an idempotent read before giving up.
+	readAttempts = 3
+	// readRetryDelay is the wait before the first retry; it doubles on each further attempt.
+	readRetryDelay = 50 * time.Millisecond
+)
+
+// IsTransient reports whether err is a connection-level failure that may succeed on a fresh
+// connection (server restart, dropped socket, failover), as opposed to a query error.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "08": // connection_exception
+			return true
+		case pqErr.Code == "57P01", pqErr.Code == "57P02", pqErr.Code == "57P03": // admin/crash shutdown, cannot_connect_now
+			return true
+		case pqErr.Code == "53300": // too_many_connections
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryRead runs read, retrying with exponential backoff while it fails with a transient error.
+// Only use it for reads (or other idempotent statements): a retried write may apply twice.
+func RetryRead(ctx context.Context, read func() error) error {
+	delay := readRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := read()
+		if err == nil || attempt == readAttempts || !IsTransient(err) {
+			return err
+		}
+		slog.WarnContext(ctx, "Transient database error, retrying read", "attempt", attempt+1, "of", readAttempts, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
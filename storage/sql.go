@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"wallet-system/models"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Helpers shared by the PostgreSQL and SQLite stores, whose schemas have the same tables and columns.
+
+// openTraced opens a pool through otelsql, so every statement run with a traced context gets a
+// span named after its SQL verb, with the statement itself as db.statement. system is the
+// db.system attribute, e.g. "postgresql".
+func openTraced(driverName, dsn, system string) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(attribute.String("db.system", system)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true, OmitConnPrepare: true}),
+		otelsql.WithSpanNameFormatter(func(_ context.Context, method otelsql.Method, query string) string {
+			if words := strings.Fields(query); len(words) > 0 {
+				return strings.ToUpper(words[0])
+			}
+			return string(method)
+		}),
+	)
+}
+
+// userColumns lists the users columns read by scanUser, in order.
+const userColumns = "id, username, created_at, fname, lname, email, email_verified_at, version, deleted_at, purged_at"
+
+// scanUser reads a row selected with userColumns into a models.User.
+func scanUser(row interface{ Scan(...interface{}) error }) (models.User, error) {
+	var u models.User
+	var verifiedAt, deletedAt, purgedAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Username, &u.CreatedAt, &u.Fname, &u.Lname, &u.Email, &verifiedAt, &u.Version, &deletedAt, &purgedAt)
+	if verifiedAt.Valid {
+		u.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if deletedAt.Valid {
+		u.DeletedAt = &deletedAt.Time
+	}
+	if purgedAt.Valid {
+		u.PurgedAt = &purgedAt.Time
+	}
+	return u, err
+}
+
+// userSortColumns maps UserSortFields to their column.
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"username":   "LOWER(username)",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+// queryRower is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getUser reads the user with id, returning ErrNotFound if there is none.
+func getUser(ctx context.Context, q queryRower, id int) (models.User, error) {
+	user, err := scanUser(q.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return models.User{}, ErrNotFound
+	}
+	return user, err
+}
+
+// findUserConflict returns ErrUsernameTaken or ErrEmailTaken when username or email is used by a
+// user other than excludeID. Both are compared case-insensitively.
+func findUserConflict(ctx context.Context, q queryRower, username, email string, excludeID int) error {
+	var usernameTaken, emailTaken bool
+	err := q.QueryRowContext(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND id <> $3),
+			EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($2) AND id <> $3)`,
+		username, email, excludeID,
+	).Scan(&usernameTaken, &emailTaken)
+	switch {
+	case err != nil:
+		return err
+	case usernameTaken:
+		return ErrUsernameTaken
+	case emailTaken:
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// updateMissError explains an update of user id that matched no row: the user was removed or
+// deactivated after it was read or, only when the update was conditional on expectedVersion,
+// modified since.
+func updateMissError(ctx context.Context, q queryRower, id int, expectedVersion *int) error {
+	current, err := getUser(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	if current.DeletedAt != nil {
+		return ErrUserDeactivated
+	}
+	if expectedVersion != nil {
+		return ErrVersionMismatch
+	}
+	return fmt.Errorf("updating user %d: no row matched", id)
+}
+
+// userUpdateSQL builds the UPDATE statement for UserStore.Update. It bumps the version, clears the
+// verification of a changed email and, when expectedVersion is set, matches no row on a version mismatch.
+func userUpdateSQL(id int, changes UserChanges, expectedVersion *int) (string, []interface{}) {
+	// Collect the SET clauses for the supplied fields
+	var sets []string
+	var args []interface{}
+	set := func(column string, value string) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if changes.Username != nil {
+		set("username", *changes.Username)
+	}
+	if changes.Fname != nil {
+		set("fname", *changes.Fname)
+	}
+	if changes.Lname != nil {
+		set("lname", *changes.Lname)
+	}
+	if changes.Email != nil {
+		set("email", *changes.Email)
+		// A changed email has to be verified again
+		sets = append(sets, fmt.Sprintf("email_verified_at = CASE WHEN email = $%d THEN email_verified_at ELSE NULL END", len(args)))
+	}
+
+	sets = append(sets, "version = version + 1")
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d AND deleted_at IS NULL`, strings.Join(sets, ", "), len(args))
+	if expectedVersion != nil {
+		args = append(args, *expectedVersion)
+		query += fmt.Sprintf(" AND version = $%d", len(args))
+	}
+	return query, args
+}
+
+// listUsers implements UserStore.List for the SQL backends; like is the case-insensitive LIKE operator.
+func listUsers(ctx context.Context, db *sql.DB, f UserFilter, like string) ([]models.User, int, error) {
+	// Filters, collected as WHERE conditions with positional arguments
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Query != "" {
+		p := arg(escapeLike(f.Query) + "%")
+		conditions = append(conditions, fmt.Sprintf(
+			`(username %[1]s %[2]s ESCAPE '\' OR fname %[1]s %[2]s ESCAPE '\' OR lname %[1]s %[2]s ESCAPE '\' OR email %[1]s %[2]s ESCAPE '\')`, like, p))
+	}
+	switch f.Status {
+	case "active":
+		conditions = append(conditions, "deleted_at IS NULL")
+	case "deleted":
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	}
+	if f.Verified != nil {
+		if *f.Verified {
+			conditions = append(conditions, "email_verified_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "email_verified_at IS NULL")
+		}
+	}
+	if f.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= "+arg(f.CreatedFrom.UTC()))
+	}
+	if f.CreatedTo != nil {
+		conditions = append(conditions, "created_at <= "+arg(f.CreatedTo.UTC()))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	column, ok := userSortColumns[f.Sort]
+	if f.Sort == "" {
+		column, ok = "id", true
+	}
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown user sort field %q", f.Sort)
+	}
+	direction := "ASC"
+	if f.Descending {
+		direction = "DESC"
+	}
+
+	// Total number of matches, for the client's pager
+	var total int
+	err := RetryRead(ctx, func() error {
+		return db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+where, args...).Scan(&total)
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("counting users: %w", err)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM users %s ORDER BY %s %s, id %s LIMIT %s OFFSET %s`,
+		userColumns, where, column, direction, direction, arg(f.Limit), arg(f.Offset))
+	var rows *sql.Rows
+	err = RetryRead(ctx, func() (err error) {
+		rows, err = db.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied prefix.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// amountColumn is how a SQL backend stores transaction amounts: in column, and in currency units
+// once a value or a sum of it is followed by scale (such as " / 100.0" for cents).
+type amountColumn struct {
+	column string
+	scale  string
+}
+
+// listTransactions implements TransactionStore.ListByUser for the SQL backends.
+func listTransactions(ctx context.Context, db *sql.DB, amount amountColumn, userID int) ([]models.Transaction, error) {
+	var rows *sql.Rows
+	err := RetryRead(ctx, func() (err error) {
+		rows, err = db.QueryContext(ctx,
+			"SELECT transaction_id, user_id, user_name, type, "+amount.column+amount.scale+", created_at FROM transactions WHERE user_id = $1 ORDER BY transaction_id",
+			userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		t := models.Transaction{Status: "completed"}
+		if err := rows.Scan(&t.TransactionID, &t.UserID, &t.UserName, &t.Type, &t.Amount, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// transactionSummary implements TransactionStore.Summary for the SQL backends. Amounts are summed
+// before they are scaled, so the totals are exact.
+func transactionSummary(ctx context.Context, db *sql.DB, amount amountColumn, userID int) (models.TransactionSummary, error) {
+	var sum models.TransactionSummary
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE type = 'credit'),
+			COUNT(*) FILTER (WHERE type = 'debit'),
+			COALESCE(SUM(%[1]s) FILTER (WHERE type = 'credit')%[2]s, 0),
+			COALESCE(SUM(%[1]s) FILTER (WHERE type = 'debit')%[2]s, 0)
+		FROM transactions WHERE user_id = $1`, amount.column, amount.scale)
+	err := RetryRead(ctx, func() error {
+		return db.QueryRowContext(ctx, query, userID).Scan(
+			&sum.TotalTransactions,
+			&sum.TotalCredits,
+			&sum.TotalDebits,
+			&sum.TotalCreditedAmount,
+			&sum.TotalDebitedAmount,
+		)
+	})
+	return sum, err
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"wallet-system/config"
+)
+
+// TestUpdateMissError covers the explanations of an UPDATE that matched no row, which the stores
+// only hit when another request changes the user between their check and the update.
+func TestUpdateMissError(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "wallet.db")
+	db, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := MigrateUp(ctx, db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	users := NewSQLiteStores(db).Users
+	u, err := users.Create(ctx, NewUser{Username: "jdoe", Fname: "John", Lname: "Doe", Email: "j@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := u.Version
+	if err := updateMissError(ctx, db, u.ID, &version); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("active user, conditional update: err = %v, want ErrVersionMismatch", err)
+	}
+	if err := updateMissError(ctx, db, u.ID, nil); err == nil || errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("active user, unconditional update: err = %v, want an error other than ErrVersionMismatch", err)
+	}
+
+	if err := users.Deactivate(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []*int{nil, &version} {
+		if err := updateMissError(ctx, db, u.ID, expected); !errors.Is(err, ErrUserDeactivated) {
+			t.Errorf("deactivated user: err = %v, want ErrUserDeactivated", err)
+		}
+	}
+	if err := updateMissError(ctx, db, u.ID+1, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing user: err = %v, want ErrNotFound", err)
+	}
+}
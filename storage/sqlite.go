@@ -0,0 +1,397 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"wallet-system/config"
+	"wallet-system/models"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// connectSQLite opens (creating if needed) the SQLite database file cfg.Path.
+//
+// The database runs in WAL mode so reads never wait for the writer, times are written in SQLite's
+// own text format, and every transaction starts with BEGIN IMMEDIATE so it takes the write lock
+// up front instead of failing with SQLITE_BUSY when it later tries to write.
+func connectSQLite(cfg config.DatabaseConfig) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Set("_time_format", "sqlite")
+	params.Set("_txlock", "immediate")
+
+	db, err := openTraced("sqlite", "file:"+cfg.Path+"?"+params.Encode(), "sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime))
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", cfg.Path, err)
+	}
+
+	log.Printf("Using SQLite database %s", cfg.Path)
+	return db, nil
+}
+
+// sqliteDB is the database shared by the SQLite stores.
+//
+// SQLite allows a single writer at a time. Rather than have concurrent write transactions queue
+// on the file lock (and time out under load), writes from this process take writeMu first, so
+// they run one after another and the wallet balance is always read and updated atomically.
+// writeMu is therefore also the wallet lock.
+type sqliteDB struct {
+	db      *sql.DB
+	writeMu waitLock
+}
+
+// write runs fn in a transaction, serialized with every other write of this process.
+func (s *sqliteDB) write(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.writeWithin(ctx, 0, fn)
+}
+
+// writeWithin is write, giving up with ErrWalletBusy if the other writes ahead of it hold it up
+// for longer than lockTimeout (0 for no limit) and with the context's error if ctx ends first.
+func (s *sqliteDB) writeWithin(ctx context.Context, lockTimeout time.Duration, fn func(tx *sql.Tx) error) error {
+	if err := s.writeMu.LockContext(ctx, lockTimeout); err != nil {
+		return err
+	}
+	defer s.writeMu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteNow returns the current time as stored by the SQLite backend. Timestamps are always UTC,
+// so that their text form sorts chronologically.
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+// sqliteUniqueViolation maps a unique-index violation on users to ErrUsernameTaken or ErrEmailTaken
+// and returns any other error unchanged.
+func sqliteUniqueViolation(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return err
+	}
+	switch {
+	case strings.Contains(sqliteErr.Error(), "users_username_lower_idx"):
+		return ErrUsernameTaken
+	case strings.Contains(sqliteErr.Error(), "users_email_lower_idx"):
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// NewSQLiteStores returns the SQLite implementation of every store, sharing db.
+func NewSQLiteStores(db *sql.DB) Stores {
+	s := &sqliteDB{db: db, writeMu: newWaitLock()}
+	return Stores{
+		Users:        &SQLiteUsers{s},
+		Wallet:       &SQLiteWallet{s},
+		Transactions: &SQLiteTransactions{s},
+	}
+}
+
+// SQLiteUsers is the SQLite UserStore.
+type SQLiteUsers struct {
+	s *sqliteDB
+}
+
+func (u *SQLiteUsers) Create(ctx context.Context, nu NewUser) (models.User, error) {
+	var user models.User
+	err := u.s.write(ctx, func(tx *sql.Tx) error {
+		if err := findUserConflict(ctx, tx, nu.Username, nu.Email, 0); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO users (username, fname, lname, email, created_at) VALUES ($1, $2, $3, $4, $5)",
+			nu.Username, nu.Fname, nu.Lname, nu.Email, sqliteNow())
+		if err != nil {
+			return sqliteUniqueViolation(err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		user, err = getUser(ctx, tx, int(id))
+		return err
+	})
+	return user, err
+}
+
+func (u *SQLiteUsers) Get(ctx context.Context, id int) (models.User, error) {
+	return getUser(ctx, u.s.db, id)
+}
+
+func (u *SQLiteUsers) List(ctx context.Context, f UserFilter) ([]models.User, int, error) {
+	// LIKE is case-insensitive for ASCII in SQLite
+	return listUsers(ctx, u.s.db, f, "LIKE")
+}
+
+func (u *SQLiteUsers) Update(ctx context.Context, id int, changes UserChanges, expectedVersion *int) (models.User, error) {
+	var user models.User
+	err := u.s.write(ctx, func(tx *sql.Tx) error {
+		current, err := getUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current.DeletedAt != nil {
+			return ErrUserDeactivated
+		}
+
+		var username, email string
+		if changes.Username != nil {
+			username = *changes.Username
+		}
+		if changes.Email != nil {
+			email = *changes.Email
+		}
+		if err := findUserConflict(ctx, tx, username, email, id); err != nil {
+			return err
+		}
+
+		query, args := userUpdateSQL(id, changes, expectedVersion)
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return sqliteUniqueViolation(err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return updateMissError(ctx, tx, id, expectedVersion)
+		}
+		user, err = getUser(ctx, tx, id)
+		return err
+	})
+	return user, err
+}
+
+func (u *SQLiteUsers) Deactivate(ctx context.Context, id int) error {
+	return u.s.write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE users SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", sqliteNow(), id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			if _, err := getUser(ctx, tx, id); err != nil {
+				return err
+			}
+			return ErrUserDeactivated
+		}
+		return nil
+	})
+}
+
+func (u *SQLiteUsers) Restore(ctx context.Context, id int) error {
+	return u.s.write(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL AND purged_at IS NULL", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (u *SQLiteUsers) Purge(ctx context.Context, id int) error {
+	return u.s.write(ctx, func(tx *sql.Tx) error {
+		user, err := getUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if user.PurgedAt != nil {
+			return ErrUserPurged
+		}
+
+		now := sqliteNow()
+		placeholder := fmt.Sprintf("deleted-user-%d", id)
+		_, err = tx.ExecContext(ctx,
+			`UPDATE users
+			SET username = $1, fname = 'Deleted', lname = 'User', email = $2,
+				deleted_at = COALESCE(deleted_at, $3), purged_at = $3
+			WHERE id = $4`,
+			placeholder, placeholder+"@invalid", now, id,
+		)
+		if err != nil {
+			return fmt.Errorf("anonymizing user: %w", err)
+		}
+
+		// Transactions carry a copy of the username; replace it but keep amounts and user_id intact
+		_, err = tx.ExecContext(ctx, "UPDATE transactions SET user_name = $1 WHERE user_id = $2", placeholder, id)
+		if err != nil {
+			return fmt.Errorf("anonymizing transactions: %w", err)
+		}
+		return nil
+	})
+}
+
+func (u *SQLiteUsers) CreateVerificationToken(ctx context.Context, tokenHash string, userID int, email string, expiresAt time.Time) error {
+	return u.s.write(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO email_verification_tokens (token_hash, user_id, email, expires_at) VALUES ($1, $2, $3, $4)",
+			tokenHash, userID, email, expiresAt.UTC(),
+		)
+		return err
+	})
+}
+
+func (u *SQLiteUsers) HasPendingVerification(ctx context.Context, userID int, email string) (bool, error) {
+	var pending bool
+	err := u.s.db.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM email_verification_tokens
+			WHERE user_id = $1 AND email = $2 AND used_at IS NULL AND expires_at > $3)`,
+		userID, email, sqliteNow(),
+	).Scan(&pending)
+	return pending, err
+}
+
+func (u *SQLiteUsers) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := u.s.write(ctx, func(tx *sql.Tx) error {
+		// Consume the token; expired, used or unknown tokens match no row
+		now := sqliteNow()
+		var email string
+		err := tx.QueryRowContext(ctx,
+			`UPDATE email_verification_tokens SET used_at = $1
+			WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+			RETURNING user_id, email`,
+			now, tokenHash,
+		).Scan(&userID, &email)
+		if err == sql.ErrNoRows {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return fmt.Errorf("consuming verification token: %w", err)
+		}
+
+		// Only verify if the user still has the email the token was issued for
+		res, err := tx.ExecContext(ctx,
+			"UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email = $3 AND deleted_at IS NULL",
+			now, userID, email,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrInvalidToken
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (u *SQLiteUsers) DeleteStaleVerificationTokens(ctx context.Context) (int64, error) {
+	var n int64
+	err := u.s.write(ctx, func(tx *sql.Tx) error {
+		cutoff := sqliteNow().Add(-24 * time.Hour)
+		res, err := tx.ExecContext(ctx,
+			"DELETE FROM email_verification_tokens WHERE expires_at < $1 OR used_at < $1", cutoff)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// SQLiteWallet is the SQLite WalletStore.
+type SQLiteWallet struct {
+	s *sqliteDB
+}
+
+func (w *SQLiteWallet) Get(ctx context.Context) (models.SharedWallet, error) {
+	var wallet models.SharedWallet
+	var balance int64
+	err := w.s.db.QueryRowContext(ctx, "SELECT balance_cents, created_at FROM shared_wallet WHERE id = 1").Scan(&balance, &wallet.CreatedAt)
+	wallet.Balance = fromCents(balance)
+	return wallet, err
+}
+
+// Apply runs as a serialized write transaction, so no other entry can change the balance between
+// the check and the update. Money is kept in whole cents: REAL would drift off the cent.
+func (w *SQLiteWallet) Apply(ctx context.Context, e WalletEntry) (WalletResult, error) {
+	var result WalletResult
+	err := w.s.writeWithin(ctx, e.LockTimeout, func(tx *sql.Tx) error {
+		e.locked()
+
+		var balance int64
+		if err := tx.QueryRowContext(ctx, "SELECT balance_cents FROM shared_wallet WHERE id = 1").Scan(&balance); err != nil {
+			return fmt.Errorf("reading wallet: %w", err)
+		}
+
+		amount := e.cents()
+		delta := amount
+		if e.Type == "debit" {
+			if amount > balance {
+				return ErrInsufficientBalance
+			}
+			delta = -amount
+		}
+		err := tx.QueryRowContext(ctx, "UPDATE shared_wallet SET balance_cents = balance_cents + $1 WHERE id = 1 RETURNING balance_cents", delta).Scan(&balance)
+		if err != nil {
+			return fmt.Errorf("updating balance: %w", err)
+		}
+
+		t := models.Transaction{UserID: e.UserID, UserName: e.UserName, Type: e.Type, Amount: fromCents(amount), CreatedAt: sqliteNow(), Status: "completed"}
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO transactions (user_id, user_name, type, amount_cents, created_at) VALUES ($1, $2, $3, $4, $5)",
+			e.UserID, e.UserName, e.Type, amount, t.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("recording transaction: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		t.TransactionID = int(id)
+
+		result = WalletResult{Transaction: t, Balance: fromCents(balance)}
+		return nil
+	})
+	return result, err
+}
+
+// sqliteAmount reads the amounts the SQLite schema keeps in cents.
+var sqliteAmount = amountColumn{column: "amount_cents", scale: " / 100.0"}
+
+// SQLiteTransactions is the SQLite TransactionStore.
+type SQLiteTransactions struct {
+	s *sqliteDB
+}
+
+func (t *SQLiteTransactions) ListByUser(ctx context.Context, userID int) ([]models.Transaction, error) {
+	return listTransactions(ctx, t.s.db, sqliteAmount, userID)
+}
+
+func (t *SQLiteTransactions) Summary(ctx context.Context, userID int) (models.TransactionSummary, error) {
+	return transactionSummary(ctx, t.s.db, sqliteAmount, userID)
+}
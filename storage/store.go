@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"wallet-system/models"
+)
+
+// Errors returned by the stores. Backends wrap or return them unchanged so callers can use errors.Is.
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrUsernameTaken       = errors.New("username is already taken")
+	ErrEmailTaken          = errors.New("email is already registered")
+	ErrUserDeactivated     = errors.New("user is deactivated")
+	ErrUserPurged          = errors.New("user is purged")
+	ErrVersionMismatch     = errors.New("user has been modified since it was read")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInvalidToken        = errors.New("invalid or expired verification token")
+	ErrWalletBusy          = errors.New("timed out waiting for the wallet lock")
+)
+
+// UserSortFields are the keys UserFilter.Sort accepts.
+var UserSortFields = []string{"id", "username", "email", "created_at"}
+
+// Stores bundles one implementation of every store, as handed to the HTTP layer.
+type Stores struct {
+	Users        UserStore
+	Wallet       WalletStore
+	Transactions TransactionStore
+}
+
+// NewUser holds the fields of a user being created.
+type NewUser struct {
+	Username string
+	Fname    string
+	Lname    string
+	Email    string
+}
+
+// UserChanges lists the fields of an update; nil fields are left unchanged.
+type UserChanges struct {
+	Username *string
+	Fname    *string
+	Lname    *string
+	Email    *string
+}
+
+// UserFilter selects and orders a page of users.
+type UserFilter struct {
+	Query       string     // case-insensitive prefix of username, first name, last name or email
+	Status      string     // "active", "deleted" or "" for both
+	Verified    *bool      // nil for both
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // inclusive
+	Sort        string     // one of UserSortFields, "" for id
+	Descending  bool
+	Limit       int
+	Offset      int
+}
+
+// UserStore persists users and their email verification tokens.
+type UserStore interface {
+	// Create inserts a user. It returns ErrUsernameTaken or ErrEmailTaken when either is already used,
+	// compared case-insensitively.
+	Create(ctx context.Context, u NewUser) (models.User, error)
+
+	// Get returns the user with id, including deactivated and purged users, or ErrNotFound.
+	Get(ctx context.Context, id int) (models.User, error)
+
+	// List returns one page of the users matching f and the total number of matches.
+	List(ctx context.Context, f UserFilter) ([]models.User, int, error)
+
+	// Update applies changes to an active user and bumps its version; a changed email is marked unverified.
+	// When expectedVersion is non-nil the update only happens if the stored version still matches,
+	// otherwise ErrVersionMismatch is returned. ErrNotFound, ErrUserDeactivated, ErrUsernameTaken
+	// and ErrEmailTaken are returned as their names say.
+	Update(ctx context.Context, id int, changes UserChanges, expectedVersion *int) (models.User, error)
+
+	// Deactivate soft-deletes an active user. It returns ErrNotFound or ErrUserDeactivated.
+	Deactivate(ctx context.Context, id int) error
+
+	// Restore reactivates a deactivated user that is not purged; otherwise it returns ErrNotFound.
+	Restore(ctx context.Context, id int) error
+
+	// Purge anonymizes a user's personal data, including the username copied onto their transactions.
+	// It returns ErrNotFound or ErrUserPurged.
+	Purge(ctx context.Context, id int) error
+
+	// CreateVerificationToken stores the hash of a token that verifies email for userID until expiresAt.
+	CreateVerificationToken(ctx context.Context, tokenHash string, userID int, email string, expiresAt time.Time) error
+
+	// HasPendingVerification reports whether userID has an unused, unexpired token for email.
+	HasPendingVerification(ctx context.Context, userID int, email string) (bool, error)
+
+	// VerifyEmail consumes the token with tokenHash and marks the user's email verified, provided the
+	// user is active and still has the email the token was issued for. It returns the user ID, or
+	// ErrInvalidToken.
+	VerifyEmail(ctx context.Context, tokenHash string) (int, error)
+
+	// DeleteStaleVerificationTokens removes tokens that expired or were used more than a day ago and
+	// returns how many were removed.
+	DeleteStaleVerificationTokens(ctx context.Context) (int64, error)
+}
+
+// WalletEntry is a debit or credit to apply to the shared wallet.
+type WalletEntry struct {
+	UserID   int
+	UserName string
+	Type     string  // "debit" or "credit"
+	Amount   float64 // stored to the cent, like PostgreSQL's NUMERIC(14,2)
+
+	// Locked, if set, is called as soon as the entry holds the wallet lock, before the balance is
+	// checked, so callers can measure how long it waited behind other entries.
+	Locked func()
+
+	// LockTimeout, if positive, bounds the wait for the wallet lock; past it Apply gives up with
+	// ErrWalletBusy. The context passed to Apply bounds the wait either way.
+	LockTimeout time.Duration
+}
+
+// locked calls e.Locked if it is set.
+func (e WalletEntry) locked() {
+	if e.Locked != nil {
+		e.Locked()
+	}
+}
+
+// cents returns e.Amount in whole cents, rounded half away from zero as NUMERIC rounds it.
+func (e WalletEntry) cents() int64 {
+	return toCents(e.Amount)
+}
+
+// toCents and fromCents convert amounts to and from whole cents. Stores that can't hold decimals
+// exactly keep money in cents, so that sums and balance checks don't drift.
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// WalletResult is the outcome of a successfully applied WalletEntry.
+type WalletResult struct {
+	Transaction models.Transaction
+	Balance     float64 // wallet balance after the entry
+}
+
+// WalletStore persists the shared wallet.
+type WalletStore interface {
+	// Get returns the wallet's balance and creation time.
+	Get(ctx context.Context) (models.SharedWallet, error)
+
+	// Apply atomically updates the balance and records the transaction. Concurrent calls are
+	// serialized; a debit larger than the balance returns ErrInsufficientBalance, and a wait for
+	// the lock longer than e.LockTimeout returns ErrWalletBusy. Either way nothing changes.
+	Apply(ctx context.Context, e WalletEntry) (WalletResult, error)
+}
+
+// TransactionStore reads the transaction ledger.
+type TransactionStore interface {
+	// ListByUser returns the user's transactions, oldest first.
+	ListByUser(ctx context.Context, userID int) ([]models.Transaction, error)
+
+	// Summary totals the user's credits and debits.
+	Summary(ctx context.Context, userID int) (models.TransactionSummary, error)
+}
@@ -0,0 +1,65 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"wallet-system/config"
+	database "wallet-system/storage"
+	"wallet-system/storage/storetest"
+)
+
+func TestMemoryStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Stores {
+		return database.NewMemoryStores()
+	})
+}
+
+func TestSQLiteStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Stores {
+		cfg := config.Default().Database
+		cfg.Driver = "sqlite"
+		cfg.Path = filepath.Join(t.TempDir(), "wallet.db")
+		db := openMigrated(t, cfg)
+		return database.NewSQLiteStores(db)
+	})
+}
+
+// TestPostgresStores runs against the database described by the usual DB_* variables when
+// WALLET_TEST_POSTGRES=1. Every table is emptied before each subtest.
+func TestPostgresStores(t *testing.T) {
+	if os.Getenv("WALLET_TEST_POSTGRES") != "1" {
+		t.Skip("set WALLET_TEST_POSTGRES=1 to run against PostgreSQL")
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database.Driver = "postgres"
+	db := openMigrated(t, cfg.Database)
+
+	storetest.Run(t, func(t *testing.T) database.Stores {
+		_, err := db.Exec(`TRUNCATE transactions, email_verification_tokens, users RESTART IDENTITY CASCADE;
+			UPDATE shared_wallet SET balance = 0 WHERE id = 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return database.NewPostgresStores(db)
+	})
+}
+
+func openMigrated(t *testing.T, cfg config.DatabaseConfig) *sql.DB {
+	t.Helper()
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.MigrateUp(context.Background(), db, cfg.Driver); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,508 @@
+// Package storetest is the behavioral test suite every storage backend must pass, so that the
+// PostgreSQL, SQLite and in-memory stores stay interchangeable.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	database "wallet-system/storage"
+)
+
+// Run runs the suite. open must return stores over an empty database (no users, no transactions,
+// a zero wallet balance); it is called once per subtest.
+func Run(t *testing.T, open func(t *testing.T) database.Stores) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s database.Stores)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"UniqueUsernameAndEmail", testUniqueUsernameAndEmail},
+		{"Update", testUpdate},
+		{"UpdateVersionMismatch", testUpdateVersionMismatch},
+		{"DeactivateRestorePurge", testDeactivateRestorePurge},
+		{"List", testList},
+		{"EmailVerification", testEmailVerification},
+		{"WalletApply", testWalletApply},
+		{"WalletCents", testWalletCents},
+		{"ConcurrentDebits", testConcurrentDebits},
+		{"WalletBusy", testWalletBusy},
+		{"TransactionHistory", testTransactionHistory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+func str(s string) *string { return &s }
+
+func createUser(t *testing.T, s database.Stores, username, email string) int {
+	t.Helper()
+	u, err := s.Users.Create(context.Background(), database.NewUser{Username: username, Fname: "Test", Lname: "User", Email: email})
+	if err != nil {
+		t.Fatalf("Create(%s): %v", username, err)
+	}
+	return u.ID
+}
+
+func wantErr(t *testing.T, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Fatalf("err = %v, want %v", got, want)
+	}
+}
+
+func testCreateAndGet(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	created, err := s.Users.Create(ctx, database.NewUser{Username: "jdoe", Fname: "John", Lname: "Doe", Email: "john@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || created.Version != 1 || created.CreatedAt.IsZero() || created.EmailVerifiedAt != nil {
+		t.Fatalf("unexpected new user %+v", created)
+	}
+
+	got, err := s.Users.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "jdoe" || got.Fname != "John" || got.Lname != "Doe" || got.Email != "john@example.com" || got.Version != 1 {
+		t.Fatalf("Get = %+v", got)
+	}
+	if d := got.CreatedAt.Sub(created.CreatedAt); d > time.Millisecond || d < -time.Millisecond {
+		t.Fatalf("CreatedAt = %v, want %v", got.CreatedAt, created.CreatedAt)
+	}
+
+	_, err = s.Users.Get(ctx, created.ID+1000)
+	wantErr(t, err, database.ErrNotFound)
+}
+
+func testUniqueUsernameAndEmail(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	createUser(t, s, "jdoe", "john@example.com")
+	other := createUser(t, s, "jane", "jane@example.com")
+
+	_, err := s.Users.Create(ctx, database.NewUser{Username: "JDoe", Fname: "J", Lname: "D", Email: "new@example.com"})
+	wantErr(t, err, database.ErrUsernameTaken)
+	_, err = s.Users.Create(ctx, database.NewUser{Username: "new", Fname: "J", Lname: "D", Email: "JOHN@example.com"})
+	wantErr(t, err, database.ErrEmailTaken)
+
+	_, err = s.Users.Update(ctx, other, database.UserChanges{Username: str("JDOE")}, nil)
+	wantErr(t, err, database.ErrUsernameTaken)
+	_, err = s.Users.Update(ctx, other, database.UserChanges{Email: str("john@EXAMPLE.com")}, nil)
+	wantErr(t, err, database.ErrEmailTaken)
+
+	// A user may keep (or re-case) their own username
+	if _, err := s.Users.Update(ctx, other, database.UserChanges{Username: str("Jane")}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testUpdate(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+
+	u, err := s.Users.Update(ctx, id, database.UserChanges{Fname: str("Johnny")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Fname != "Johnny" || u.Lname != "User" || u.Version != 2 {
+		t.Fatalf("after patch: %+v", u)
+	}
+
+	_, err = s.Users.Update(ctx, id+1000, database.UserChanges{Fname: str("X")}, nil)
+	wantErr(t, err, database.ErrNotFound)
+
+	if err := s.Users.Deactivate(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Users.Update(ctx, id, database.UserChanges{Fname: str("X")}, nil)
+	wantErr(t, err, database.ErrUserDeactivated)
+}
+
+func testUpdateVersionMismatch(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+
+	stale := 1
+	if _, err := s.Users.Update(ctx, id, database.UserChanges{Lname: str("Doe")}, &stale); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Users.Update(ctx, id, database.UserChanges{Lname: str("Roe")}, &stale)
+	wantErr(t, err, database.ErrVersionMismatch)
+
+	current := 2
+	u, err := s.Users.Update(ctx, id, database.UserChanges{Lname: str("Roe")}, &current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Lname != "Roe" || u.Version != 3 {
+		t.Fatalf("after conditional update: %+v", u)
+	}
+}
+
+func testDeactivateRestorePurge(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+	if _, err := s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "credit", Amount: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantErr(t, s.Users.Deactivate(ctx, id+1000), database.ErrNotFound)
+	wantErr(t, s.Users.Restore(ctx, id), database.ErrNotFound) // not deactivated
+
+	if err := s.Users.Deactivate(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	wantErr(t, s.Users.Deactivate(ctx, id), database.ErrUserDeactivated)
+	if u, _ := s.Users.Get(ctx, id); u.DeletedAt == nil {
+		t.Fatal("DeletedAt not set after Deactivate")
+	}
+
+	if err := s.Users.Restore(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := s.Users.Get(ctx, id); u.DeletedAt != nil {
+		t.Fatal("DeletedAt still set after Restore")
+	}
+
+	if err := s.Users.Purge(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	wantErr(t, s.Users.Purge(ctx, id), database.ErrUserPurged)
+	wantErr(t, s.Users.Purge(ctx, id+1000), database.ErrNotFound)
+	wantErr(t, s.Users.Restore(ctx, id), database.ErrNotFound)
+
+	u, err := s.Users.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.PurgedAt == nil || u.DeletedAt == nil || u.Username == "jdoe" || u.Email == "john@example.com" {
+		t.Fatalf("user not anonymized: %+v", u)
+	}
+	list, err := s.Transactions.ListByUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].UserName != u.Username || list[0].Amount != 10 {
+		t.Fatalf("transactions after purge: %+v", list)
+	}
+
+	// The purged username and email are free again
+	createUser(t, s, "jdoe", "john@example.com")
+}
+
+func testList(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice", "alice@example.com")
+	createUser(t, s, "bob", "bob@example.com")
+	carol := createUser(t, s, "Carol_1", "carol@example.com")
+	if err := s.Users.Deactivate(ctx, carol); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(f database.UserFilter) ([]int, int) {
+		t.Helper()
+		users, total, err := s.Users.List(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+		return ids, total
+	}
+
+	if got, total := ids(database.UserFilter{Limit: 2}); len(got) != 2 || total != 3 || got[0] != alice {
+		t.Errorf("first page = %v (total %d)", got, total)
+	}
+	if got, total := ids(database.UserFilter{Limit: 2, Offset: 2}); len(got) != 1 || total != 3 || got[0] != carol {
+		t.Errorf("second page = %v (total %d)", got, total)
+	}
+	if got, _ := ids(database.UserFilter{Sort: "username", Descending: true, Limit: 10}); len(got) != 3 || got[0] != carol || got[2] != alice {
+		t.Errorf("sorted by username descending = %v", got)
+	}
+	if got, _ := ids(database.UserFilter{Query: "CAROL_", Limit: 10}); len(got) != 1 || got[0] != carol {
+		t.Errorf("q=CAROL_ = %v", got)
+	}
+	if got, _ := ids(database.UserFilter{Query: "a%", Limit: 10}); len(got) != 0 {
+		t.Errorf("q=a%% matched %v, want wildcards escaped", got)
+	}
+	if got, _ := ids(database.UserFilter{Status: "active", Limit: 10}); len(got) != 2 {
+		t.Errorf("status=active = %v", got)
+	}
+	if got, _ := ids(database.UserFilter{Status: "deleted", Limit: 10}); len(got) != 1 || got[0] != carol {
+		t.Errorf("status=deleted = %v", got)
+	}
+	unverified := false
+	if got, _ := ids(database.UserFilter{Verified: &unverified, Limit: 10}); len(got) != 3 {
+		t.Errorf("verified=false = %v", got)
+	}
+	future := time.Now().Add(time.Hour)
+	if got, total := ids(database.UserFilter{CreatedFrom: &future, Limit: 10}); len(got) != 0 || total != 0 {
+		t.Errorf("created_from in the future = %v (total %d)", got, total)
+	}
+	past := time.Now().Add(-time.Hour)
+	if got, _ := ids(database.UserFilter{CreatedFrom: &past, CreatedTo: &future, Limit: 10}); len(got) != 3 {
+		t.Errorf("created in the last hour = %v", got)
+	}
+}
+
+func testEmailVerification(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+	expires := time.Now().Add(time.Hour)
+
+	if pending, err := s.Users.HasPendingVerification(ctx, id, "john@example.com"); err != nil || pending {
+		t.Fatalf("pending before any token = %v, %v", pending, err)
+	}
+	if err := s.Users.CreateVerificationToken(ctx, "hash-1", id, "john@example.com", expires); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := s.Users.HasPendingVerification(ctx, id, "john@example.com"); err != nil || !pending {
+		t.Fatalf("pending after token = %v, %v", pending, err)
+	}
+
+	_, err := s.Users.VerifyEmail(ctx, "unknown")
+	wantErr(t, err, database.ErrInvalidToken)
+
+	got, err := s.Users.VerifyEmail(ctx, "hash-1")
+	if err != nil || got != id {
+		t.Fatalf("VerifyEmail = %d, %v", got, err)
+	}
+	if u, _ := s.Users.Get(ctx, id); u.EmailVerifiedAt == nil {
+		t.Fatal("EmailVerifiedAt not set")
+	}
+	_, err = s.Users.VerifyEmail(ctx, "hash-1")
+	wantErr(t, err, database.ErrInvalidToken) // already used
+
+	// Expired tokens don't verify and are cleaned up a day later
+	if err := s.Users.CreateVerificationToken(ctx, "hash-2", id, "john@example.com", time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Users.VerifyEmail(ctx, "hash-2")
+	wantErr(t, err, database.ErrInvalidToken)
+	if n, err := s.Users.DeleteStaleVerificationTokens(ctx); err != nil || n != 1 {
+		t.Fatalf("DeleteStaleVerificationTokens = %d, %v", n, err)
+	}
+
+	// Changing the email clears verification, and a token for the old email no longer works
+	if err := s.Users.CreateVerificationToken(ctx, "hash-3", id, "john@example.com", expires); err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.Users.Update(ctx, id, database.UserChanges{Email: str("johnny@example.com")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.EmailVerifiedAt != nil {
+		t.Fatal("EmailVerifiedAt kept after the email changed")
+	}
+	_, err = s.Users.VerifyEmail(ctx, "hash-3")
+	wantErr(t, err, database.ErrInvalidToken)
+}
+
+func testWalletApply(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+
+	w, err := s.Wallet.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Balance != 0 || w.CreatedAt.IsZero() {
+		t.Fatalf("new wallet = %+v", w)
+	}
+
+	res, err := s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "credit", Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Balance != 100 || res.Transaction.TransactionID == 0 || res.Transaction.Type != "credit" || res.Transaction.CreatedAt.IsZero() {
+		t.Fatalf("credit result = %+v", res)
+	}
+
+	res, err = s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "debit", Amount: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Balance != 60 {
+		t.Fatalf("balance after debit = %v, want 60", res.Balance)
+	}
+
+	_, err = s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "debit", Amount: 60.01})
+	wantErr(t, err, database.ErrInsufficientBalance)
+
+	if w, _ := s.Wallet.Get(ctx); w.Balance != 60 {
+		t.Fatalf("balance after rejected debit = %v, want 60", w.Balance)
+	}
+	if list, _ := s.Transactions.ListByUser(ctx, id); len(list) != 2 {
+		t.Fatalf("rejected debit recorded a transaction: %+v", list)
+	}
+}
+
+// testWalletCents applies amounts binary floating point can't hold exactly. Like NUMERIC(14,2),
+// every store must keep them to the cent, so a credit of 0.3 pays for three debits of 0.1.
+func testWalletCents(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+
+	entries := []database.WalletEntry{{UserID: id, UserName: "jdoe", Type: "credit", Amount: 0.3}}
+	for i := 0; i < 3; i++ {
+		entries = append(entries, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "debit", Amount: 0.1})
+	}
+	for i, e := range entries {
+		if _, err := s.Wallet.Apply(ctx, e); err != nil {
+			t.Fatalf("entry %d (%s of %v): %v", i, e.Type, e.Amount, err)
+		}
+	}
+	if w, _ := s.Wallet.Get(ctx); w.Balance != 0 {
+		t.Fatalf("balance = %v, want 0", w.Balance)
+	}
+
+	for _, amount := range []float64{0.1, 0.2, 1.15} {
+		if _, err := s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "credit", Amount: amount}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w, _ := s.Wallet.Get(ctx); w.Balance != 1.45 {
+		t.Fatalf("balance = %v, want 1.45", w.Balance)
+	}
+	sum, err := s.Transactions.Summary(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.TotalCreditedAmount != 1.75 || sum.TotalDebitedAmount != 0.3 {
+		t.Fatalf("Summary = %+v, want 1.75 credited and 0.3 debited", sum)
+	}
+	if list, _ := s.Transactions.ListByUser(ctx, id); len(list) != 7 || list[1].Amount != 0.1 || list[6].Amount != 1.15 {
+		t.Fatalf("ListByUser = %+v", list)
+	}
+}
+
+func testConcurrentDebits(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+	if _, err := s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "credit", Amount: 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 debits of 1 against a balance of 50: exactly 50 may succeed
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "debit", Amount: 1})
+			if err != nil && !errors.Is(err, database.ErrInsufficientBalance) {
+				t.Error(err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 50 {
+		t.Errorf("%d debits succeeded, want 50", succeeded)
+	}
+	if w, _ := s.Wallet.Get(ctx); w.Balance != 0 {
+		t.Errorf("final balance = %v, want 0", w.Balance)
+	}
+}
+
+func testWalletBusy(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+
+	// Hold the wallet lock until release is closed
+	locked, release := make(chan struct{}), make(chan struct{})
+	held := make(chan error, 1)
+	go func() {
+		_, err := s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "credit", Amount: 10, Locked: func() {
+			close(locked)
+			<-release
+		}})
+		held <- err
+	}()
+	<-locked
+
+	_, err := s.Wallet.Apply(ctx, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "credit", Amount: 1, LockTimeout: 50 * time.Millisecond})
+	wantErr(t, err, database.ErrWalletBusy)
+
+	// Without a lock timeout the context still bounds the wait
+	deadline, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.Wallet.Apply(deadline, database.WalletEntry{UserID: id, UserName: "jdoe", Type: "credit", Amount: 1}); err == nil {
+		t.Fatal("Apply succeeded after its context ended")
+	}
+
+	close(release)
+	if err := <-held; err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := s.Wallet.Get(ctx); w.Balance != 10 {
+		t.Fatalf("balance = %v, want 10: entries that gave up must change nothing", w.Balance)
+	}
+	if list, _ := s.Transactions.ListByUser(ctx, id); len(list) != 1 {
+		t.Fatalf("entries that gave up were recorded: %+v", list)
+	}
+}
+
+func testTransactionHistory(t *testing.T, s database.Stores) {
+	ctx := context.Background()
+	id := createUser(t, s, "jdoe", "john@example.com")
+	other := createUser(t, s, "jane", "jane@example.com")
+
+	entries := []database.WalletEntry{
+		{UserID: id, UserName: "jdoe", Type: "credit", Amount: 30},
+		{UserID: other, UserName: "jane", Type: "credit", Amount: 5},
+		{UserID: id, UserName: "jdoe", Type: "debit", Amount: 10},
+		{UserID: id, UserName: "jdoe", Type: "credit", Amount: 2.5},
+	}
+	for _, e := range entries {
+		if _, err := s.Wallet.Apply(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := s.Transactions.ListByUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Amount != 30 || list[1].Type != "debit" || list[2].Amount != 2.5 {
+		t.Fatalf("ListByUser = %+v", list)
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i].TransactionID <= list[i-1].TransactionID {
+			t.Fatalf("ListByUser not in order: %+v", list)
+		}
+	}
+
+	sum, err := s.Transactions.Summary(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.TotalTransactions != 3 || sum.TotalCredits != 2 || sum.TotalDebits != 1 ||
+		sum.TotalCreditedAmount != 32.5 || sum.TotalDebitedAmount != 10 {
+		t.Fatalf("Summary = %+v", sum)
+	}
+
+	if list, err := s.Transactions.ListByUser(ctx, other+1000); err != nil || len(list) != 0 {
+		t.Fatalf("ListByUser(unknown) = %+v, %v", list, err)
+	}
+	if sum, err := s.Transactions.Summary(ctx, other+1000); err != nil || sum.TotalTransactions != 0 {
+		t.Fatalf("Summary(unknown) = %+v, %v", sum, err)
+	}
+}
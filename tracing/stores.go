@@ -0,0 +1,192 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"wallet-system/models"
+	database "wallet-system/storage"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// walletID is the ID of the single shared wallet, recorded on wallet spans.
+const walletID = 1
+
+// Stores wraps every store in s so each call gets a span, with the user and wallet it concerns as
+// attributes. With the SQL backends the spans of the individual statements are its children.
+func Stores(s database.Stores) database.Stores {
+	return database.Stores{
+		Users:        &users{s.Users},
+		Wallet:       &wallet{s.Wallet},
+		Transactions: &transactions{s.Transactions},
+	}
+}
+
+func start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+}
+
+// end finishes span. The store's documented errors (not found, conflicts, insufficient balance,
+// ...) are outcomes rather than failures: they are recorded as an attribute but don't mark the
+// span as failed.
+func end(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case isOutcome(err):
+		span.SetAttributes(attribute.String("store.outcome", err.Error()))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func isOutcome(err error) bool {
+	for _, e := range []error{
+		database.ErrNotFound, database.ErrUsernameTaken, database.ErrEmailTaken, database.ErrUserDeactivated,
+		database.ErrUserPurged, database.ErrVersionMismatch, database.ErrInsufficientBalance, database.ErrInvalidToken,
+		database.ErrWalletBusy,
+	} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func userID(id int) attribute.KeyValue {
+	return attribute.Int("user.id", id)
+}
+
+// users traces a UserStore.
+type users struct {
+	next database.UserStore
+}
+
+func (u *users) Create(ctx context.Context, nu database.NewUser) (user models.User, err error) {
+	ctx, span := start(ctx, "UserStore.Create")
+	defer func() { end(span, err) }()
+	user, err = u.next.Create(ctx, nu)
+	span.SetAttributes(userID(user.ID))
+	return user, err
+}
+
+func (u *users) Get(ctx context.Context, id int) (user models.User, err error) {
+	ctx, span := start(ctx, "UserStore.Get", userID(id))
+	defer func() { end(span, err) }()
+	return u.next.Get(ctx, id)
+}
+
+func (u *users) List(ctx context.Context, f database.UserFilter) (list []models.User, total int, err error) {
+	ctx, span := start(ctx, "UserStore.List", attribute.Int("page.limit", f.Limit), attribute.Int("page.offset", f.Offset))
+	defer func() { end(span, err) }()
+	list, total, err = u.next.List(ctx, f)
+	span.SetAttributes(attribute.Int("users.total", total))
+	return list, total, err
+}
+
+func (u *users) Update(ctx context.Context, id int, changes database.UserChanges, expectedVersion *int) (user models.User, err error) {
+	ctx, span := start(ctx, "UserStore.Update", userID(id), attribute.Bool("user.conditional", expectedVersion != nil))
+	defer func() { end(span, err) }()
+	return u.next.Update(ctx, id, changes, expectedVersion)
+}
+
+func (u *users) Deactivate(ctx context.Context, id int) (err error) {
+	ctx, span := start(ctx, "UserStore.Deactivate", userID(id))
+	defer func() { end(span, err) }()
+	return u.next.Deactivate(ctx, id)
+}
+
+func (u *users) Restore(ctx context.Context, id int) (err error) {
+	ctx, span := start(ctx, "UserStore.Restore", userID(id))
+	defer func() { end(span, err) }()
+	return u.next.Restore(ctx, id)
+}
+
+func (u *users) Purge(ctx context.Context, id int) (err error) {
+	ctx, span := start(ctx, "UserStore.Purge", userID(id))
+	defer func() { end(span, err) }()
+	return u.next.Purge(ctx, id)
+}
+
+func (u *users) CreateVerificationToken(ctx context.Context, tokenHash string, id int, email string, expiresAt time.Time) (err error) {
+	ctx, span := start(ctx, "UserStore.CreateVerificationToken", userID(id))
+	defer func() { end(span, err) }()
+	return u.next.CreateVerificationToken(ctx, tokenHash, id, email, expiresAt)
+}
+
+func (u *users) HasPendingVerification(ctx context.Context, id int, email string) (pending bool, err error) {
+	ctx, span := start(ctx, "UserStore.HasPendingVerification", userID(id))
+	defer func() { end(span, err) }()
+	return u.next.HasPendingVerification(ctx, id, email)
+}
+
+func (u *users) VerifyEmail(ctx context.Context, tokenHash string) (id int, err error) {
+	ctx, span := start(ctx, "UserStore.VerifyEmail")
+	defer func() { end(span, err) }()
+	id, err = u.next.VerifyEmail(ctx, tokenHash)
+	span.SetAttributes(userID(id))
+	return id, err
+}
+
+func (u *users) DeleteStaleVerificationTokens(ctx context.Context) (n int64, err error) {
+	ctx, span := start(ctx, "UserStore.DeleteStaleVerificationTokens")
+	defer func() { end(span, err) }()
+	n, err = u.next.DeleteStaleVerificationTokens(ctx)
+	span.SetAttributes(attribute.Int64("tokens.deleted", n))
+	return n, err
+}
+
+// wallet traces a WalletStore.
+type wallet struct {
+	next database.WalletStore
+}
+
+func (w *wallet) Get(ctx context.Context) (sw models.SharedWallet, err error) {
+	ctx, span := start(ctx, "WalletStore.Get", attribute.Int("wallet.id", walletID))
+	defer func() { end(span, err) }()
+	return w.next.Get(ctx)
+}
+
+// Apply adds a "wallet.locked" event when the entry gets the wallet lock, which splits the span into
+// the wait for the lock and the work done while holding it.
+func (w *wallet) Apply(ctx context.Context, e database.WalletEntry) (res database.WalletResult, err error) {
+	ctx, span := start(ctx, "WalletStore.Apply",
+		attribute.Int("wallet.id", walletID), userID(e.UserID),
+		attribute.String("transaction.type", e.Type), attribute.Float64("transaction.amount", e.Amount))
+	defer func() { end(span, err) }()
+
+	locked := e.Locked
+	e.Locked = func() {
+		span.AddEvent("wallet.locked")
+		if locked != nil {
+			locked()
+		}
+	}
+	res, err = w.next.Apply(ctx, e)
+	if err == nil {
+		span.SetAttributes(attribute.Int("transaction.id", res.Transaction.TransactionID))
+	}
+	return res, err
+}
+
+// transactions traces a TransactionStore.
+type transactions struct {
+	next database.TransactionStore
+}
+
+func (t *transactions) ListByUser(ctx context.Context, id int) (list []models.Transaction, err error) {
+	ctx, span := start(ctx, "TransactionStore.ListByUser", userID(id))
+	defer func() { end(span, err) }()
+	return t.next.ListByUser(ctx, id)
+}
+
+func (t *transactions) Summary(ctx context.Context, id int) (sum models.TransactionSummary, err error) {
+	ctx, span := start(ctx, "TransactionStore.Summary", userID(id))
+	defer func() { end(span, err) }()
+	return t.next.Summary(ctx, id)
+}
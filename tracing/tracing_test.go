@@ -0,0 +1,112 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wallet-system/config"
+	"wallet-system/middleware"
+	"wallet-system/notify"
+	"wallet-system/router"
+	database "wallet-system/storage"
+	"wallet-system/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTransactionSpans(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	cfg := config.Default()
+	cfg.Features.RequireEmailVerification = false
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Path = filepath.Join(t.TempDir(), "wallet.db")
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := database.MigrateUp(context.Background(), db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	stores := tracing.Stores(database.NewSQLiteStores(db))
+	h := middleware.Tracing(router.New(router.Dependencies{Config: cfg, Stores: stores, Notifier: notify.LogNotifier{}}))
+
+	for _, req := range []struct{ target, body string }{
+		{"/api/v1/users", `{"username":"jdoe","fname":"John","lname":"Doe","email":"j@example.com"}`},
+		{"/api/v1/transactions", `{"id":1,"username":"jdoe","type":"credit","amount":5}`},
+	} {
+		r := httptest.NewRequest("POST", req.target, strings.NewReader(req.body))
+		r.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code >= 300 {
+			t.Fatalf("POST %s: status %d (body %s)", req.target, rec.Code, rec.Body)
+		}
+	}
+
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range spans.Ended() {
+		byName[s.Name()] = s
+	}
+	server, ok := byName["POST /api/v1/transactions"]
+	if !ok {
+		t.Fatalf("no server span named after the route; got %v", names(spans.Ended()))
+	}
+	if !hasAttr(server, attribute.Int("user.id", 1)) || !hasAttr(server, attribute.Int("http.response.status_code", http.StatusOK)) {
+		t.Errorf("server span attributes = %v", server.Attributes())
+	}
+
+	apply, ok := byName["WalletStore.Apply"]
+	if !ok {
+		t.Fatalf("no WalletStore.Apply span; got %v", names(spans.Ended()))
+	}
+	if apply.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("WalletStore.Apply is not a child of the server span")
+	}
+	if !hasAttr(apply, attribute.Int("wallet.id", 1)) || !hasAttr(apply, attribute.Int("user.id", 1)) {
+		t.Errorf("WalletStore.Apply attributes = %v", apply.Attributes())
+	}
+	if events := apply.Events(); len(events) != 1 || events[0].Name != "wallet.locked" {
+		t.Errorf("WalletStore.Apply events = %v, want wallet.locked", events)
+	}
+
+	// The balance update and the ledger insert are SQL spans below Apply
+	var statements []string
+	for _, s := range spans.Ended() {
+		if s.Parent().SpanID() == apply.SpanContext().SpanID() {
+			statements = append(statements, s.Name())
+		}
+	}
+	got := strings.Join(statements, " ")
+	for _, want := range []string{"SELECT", "UPDATE", "INSERT", "sql.tx.commit"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Apply child spans %v do not include %s", statements, want)
+		}
+	}
+}
+
+func names(spans []sdktrace.ReadOnlySpan) []string {
+	var n []string
+	for _, s := range spans {
+		n = append(n, s.Name())
+	}
+	return n
+}
+
+func hasAttr(s sdktrace.ReadOnlySpan, want attribute.KeyValue) bool {
+	for _, a := range s.Attributes() {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
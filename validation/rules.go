@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	digitPattern    = regexp.MustCompile(`[0-9]`)
+	nonAlphaPattern = regexp.MustCompile(`[^a-zA-Z\s]`)
+
+	// usernamePattern: starts with a letter, then letters, digits, underscores or dots.
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.]*$`)
+
+	// emailPattern is the syntax every user email has to match.
+	emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+)
+
+// reservedUsernames can't be registered by anyone, in any letter case.
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "system": true, "support": true,
+	"api": true, "me": true, "null": true, "undefined": true, "deleted": true,
+}
+
+// Name validates a name field (Fname or Lname) based on defined rules.
+func Name(name string, fieldName string) error {
+	if name == "" {
+		return fmt.Errorf("%s is required", fieldName)
+	}
+	if strings.TrimSpace(name) != name {
+		return fmt.Errorf("%s cannot have leading or trailing spaces", fieldName)
+	}
+	if digitPattern.MatchString(name) {
+		return fmt.Errorf("%s cannot contain numbers", fieldName)
+	}
+	if nonAlphaPattern.MatchString(name) {
+		return fmt.Errorf("%s can only contain alphabetic characters and spaces", fieldName)
+	}
+	if strings.Contains(name, " ") {
+		return fmt.Errorf("%s cannot have spaces", fieldName)
+	}
+	if len(name) < 3 || len(name) > 50 {
+		return fmt.Errorf("%s must be between 3 and 50 characters long", fieldName)
+	}
+	return nil
+}
+
+// Username validates a username based on defined rules.
+func Username(username string) error {
+	if username == "" {
+		return fmt.Errorf("Username is required")
+	}
+	if len(username) < 3 || len(username) > 30 {
+		return fmt.Errorf("Username must be between 3 and 30 characters long")
+	}
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("Username must start with a letter and contain only letters, digits, underscores and dots")
+	}
+	if reservedUsernames[strings.ToLower(username)] {
+		return fmt.Errorf("Username %q is reserved", username)
+	}
+	return nil
+}
+
+// Email checks that an email is present and syntactically valid.
+func Email(email string) error {
+	if email == "" || !emailPattern.MatchString(email) {
+		return fmt.Errorf("Valid email is required")
+	}
+	return nil
+}
+
+// NormalizeEmail trims and lower-cases an email so comparisons are case-insensitive.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
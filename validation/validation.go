@@ -0,0 +1,259 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"wallet-system/response"
+)
+
+// MaxBodyBytes caps the size of a JSON request body.
+const MaxBodyBytes = 1 << 20
+
+// DecodeError is returned by DecodeJSON when the body can't be accepted.
+type DecodeError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *DecodeError) Error() string { return e.Message }
+
+// Normalizer is implemented by request types that clean up their fields (trim, lower-case, ...)
+// after decoding and before validation.
+type Normalizer interface {
+	Normalize()
+}
+
+// DecodeJSON decodes a single JSON object from the request body into dst. It requires an
+// application/json Content-Type, limits the body to MaxBodyBytes and rejects unknown fields.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &DecodeError{http.StatusUnsupportedMediaType, response.CodeUnsupportedMediaType, "Content-Type must be application/json"}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return &DecodeError{http.StatusRequestEntityTooLarge, response.CodeBodyTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", MaxBodyBytes)}
+		case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+			return &DecodeError{http.StatusBadRequest, response.CodeInvalidJSON, "Invalid JSON input"}
+		case errors.As(err, &typeErr):
+			return &DecodeError{http.StatusBadRequest, response.CodeInvalidJSON, fmt.Sprintf("%s must be a JSON %s", typeErr.Field, typeErr.Type.Kind())}
+		case errors.Is(err, io.EOF):
+			return &DecodeError{http.StatusBadRequest, response.CodeInvalidJSON, "Request body must not be empty"}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return &DecodeError{http.StatusBadRequest, response.CodeInvalidJSON, fmt.Sprintf("Unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))}
+		}
+		return &DecodeError{http.StatusBadRequest, response.CodeInvalidJSON, "Invalid JSON input"}
+	}
+
+	// Exactly one JSON value is allowed
+	if dec.More() {
+		return &DecodeError{http.StatusBadRequest, response.CodeInvalidJSON, "Request body must contain a single JSON object"}
+	}
+	return nil
+}
+
+// Bind decodes the request body into dst, normalizes it and validates it with Struct.
+// On failure it writes the error response and returns false.
+func Bind(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := DecodeJSON(w, r, dst); err != nil {
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			response.Error(w, r, decodeErr.Status, decodeErr.Code, decodeErr.Message)
+		} else {
+			response.Error(w, r, http.StatusBadRequest, response.CodeInvalidJSON, "Invalid JSON input")
+		}
+		return false
+	}
+	if n, ok := dst.(Normalizer); ok {
+		n.Normalize()
+	}
+	if errs := Struct(dst); len(errs) > 0 {
+		response.ValidationError(w, r, errs...)
+		return false
+	}
+	return true
+}
+
+// Struct validates the fields of the struct pointed to by v against their `validate` tags and
+// returns every violation. Rules are comma separated:
+//
+//	required       value must be present (non-nil pointer, non-zero value)
+//	min=N, max=N   string length or numeric value bounds
+//	gt=N           numeric value must be greater than N
+//	decimals=N     number must have at most N decimal places
+//	oneof=a|b      value must be one of the listed strings
+//	name           validation.Name rules
+//	username       validation.Username rules
+//	email          validation.Email rules
+//
+// Nil pointers and empty values are only checked by required; that lets PATCH-style requests
+// use pointer fields for "not supplied". Messages use the `label` tag, or else the JSON name.
+func Struct(v interface{}) []response.FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	var errs []response.FieldError
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		label := field.Tag.Get("label")
+		if label == "" {
+			label = name
+		}
+
+		if err := checkField(rv.Field(i), strings.Split(tag, ","), label); err != nil {
+			errs = append(errs, response.FieldError{Field: name, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// checkField applies rules to a single field value and returns the first violation.
+func checkField(value reflect.Value, rules []string, label string) error {
+	required := false
+	for _, rule := range rules {
+		if rule == "required" {
+			required = true
+		}
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if required {
+				return fmt.Errorf("%s is required", label)
+			}
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.IsZero() {
+		if required {
+			return fmt.Errorf("%s is required", label)
+		}
+		if value.Kind() != reflect.String || !hasRule(rules, "name", "username", "email") {
+			return nil
+		}
+	}
+
+	for _, rule := range rules {
+		key, arg, _ := strings.Cut(rule, "=")
+		var err error
+		switch key {
+		case "required":
+		case "min", "max", "gt":
+			err = checkBound(value, key, arg, label)
+		case "decimals":
+			err = checkDecimals(value, arg, label)
+		case "oneof":
+			options := strings.Split(arg, "|")
+			if !contains(options, fmt.Sprint(value.Interface())) {
+				err = fmt.Errorf("%s must be one of %s", label, strings.Join(options, ", "))
+			}
+		case "name":
+			err = Name(value.String(), label)
+		case "username":
+			err = Username(value.String())
+		case "email":
+			err = Email(value.String())
+		default:
+			panic(fmt.Sprintf("validation: unknown rule %q", rule))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBound applies min, max or gt. Strings are measured by length, numbers by value.
+func checkBound(value reflect.Value, key, arg, label string) error {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: bad %s argument %q", key, arg))
+	}
+
+	var n float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		n, unit = float64(len(value.String())), " characters"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		panic(fmt.Sprintf("validation: %s does not apply to %s", key, value.Kind()))
+	}
+
+	switch {
+	case key == "min" && n < limit:
+		return fmt.Errorf("%s must be at least %s%s", label, arg, unit)
+	case key == "max" && n > limit:
+		return fmt.Errorf("%s must be at most %s%s", label, arg, unit)
+	case key == "gt" && n <= limit:
+		return fmt.Errorf("%s must be greater than %s", label, arg)
+	}
+	return nil
+}
+
+// checkDecimals applies decimals=N to a float. It counts the places of the shortest decimal form
+// that parses back to the value, so 0.1 has one place although it is not exact in binary.
+func checkDecimals(value reflect.Value, arg, label string) error {
+	places, err := strconv.Atoi(arg)
+	if err != nil || places < 0 {
+		panic(fmt.Sprintf("validation: bad decimals argument %q", arg))
+	}
+	if value.Kind() != reflect.Float32 && value.Kind() != reflect.Float64 {
+		panic(fmt.Sprintf("validation: decimals does not apply to %s", value.Kind()))
+	}
+
+	s := strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits())
+	if _, frac, ok := strings.Cut(s, "."); ok && len(frac) > places {
+		return fmt.Errorf("%s must have at most %d decimal places", label, places)
+	}
+	return nil
+}
+
+func hasRule(rules []string, names ...string) bool {
+	for _, rule := range rules {
+		if contains(names, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Runner runs named background jobs on a fixed interval until it is stopped.
+type Runner struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// NewRunner returns a Runner with no jobs.
+func NewRunner() *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{ctx: ctx, cancel: cancel, running: map[string]bool{}}
+}
+
+// Every starts job in its own goroutine, calling it once right away and then every interval.
+// Errors are logged and the job keeps running; it only stops when the Runner is stopped.
+func (r *Runner) Every(name string, interval time.Duration, job func(ctx context.Context) error) {
+	r.setRunning(name, true)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer r.setRunning(name, false)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := job(r.ctx); err != nil && r.ctx.Err() == nil {
+				log.Printf("Background job %s failed: %v", name, err)
+			}
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Running reports, per job name, whether the job's goroutine is still alive.
+func (r *Runner) Running() map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	running := make(map[string]bool, len(r.running))
+	for name, ok := range r.running {
+		running[name] = ok
+	}
+	return running
+}
+
+// Stop cancels every job and waits for them to return, or for ctx to be done.
+func (r *Runner) Stop(ctx context.Context) error {
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) setRunning(name string, running bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running[name] = running
+}